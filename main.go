@@ -1,7 +1,9 @@
 package main
 
 import (
+	"fmt"
 	"log"
+	"os"
 
 	"github.com/jessevdk/go-flags"
 	"github.com/mariusdieckmann/igvmultibrowser/server"
@@ -12,19 +14,61 @@ var opts struct {
 	ConfigFile string `short:"c" long:"configfile" description:"File of the config file" default:"config/local-conf.yaml"`
 }
 
+//sampleSheetCommand Imports a sample sheet instead of starting the webserver
+type sampleSheetCommand struct {
+	Genome  string `long:"genome" description:"ID of the genome, defaults to the first configured genome"`
+	Dataset string `long:"dataset" description:"Key of the dataset of the genome, e.g. Bigwigs" required:"true"`
+	Args    struct {
+		File string `positional-arg-name:"samplesheet" description:"CSV or TSV sample sheet" required:"true"`
+	} `positional-args:"yes"`
+}
+
+func (command *sampleSheetCommand) Execute(args []string) error {
+	readConfig()
+
+	sheet, err := server.ImportSampleSheetFile(command.Genome, command.Dataset, command.Args.File)
+	if sheetErr, ok := err.(*server.SampleSheetError); ok {
+		for _, problem := range sheetErr.Problems {
+			fmt.Fprintln(os.Stderr, problem)
+		}
+		os.Exit(1)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Imported %v samples for dataset %v\n", len(sheet.Samples), sheet.DatasetID)
+	return nil
+}
+
 func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
-	_, err := flags.Parse(&opts)
+	parser := flags.NewParser(&opts, flags.Default)
+	parser.SubcommandsOptional = true
+	_, err := parser.AddCommand("samplesheet", "Import a sample sheet", "Validates a CSV or TSV sample sheet against a dataset and stores it in SampleSheets.Dir", &sampleSheetCommand{})
 	if err != nil {
 		log.Fatalln(err.Error())
 	}
 
-	viper.SetConfigFile(opts.ConfigFile)
-	err = viper.ReadInConfig()
+	_, err = parser.Parse()
 	if err != nil {
 		log.Fatalln(err.Error())
 	}
 
+	//Commands are executed by the parser
+	if parser.Active != nil {
+		return
+	}
+
+	readConfig()
 	server.Run()
 }
+
+func readConfig() {
+	viper.SetConfigFile(opts.ConfigFile)
+	err := viper.ReadInConfig()
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+}
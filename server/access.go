@@ -0,0 +1,200 @@
+package server
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+//datasetConfigKeys Maps the keys of the Datasets config section to their track types
+var datasetConfigKeys = map[string]TrackType{
+	"Bigwigs":       BigWigs,
+	"Bam":           BAM,
+	"Cram":          CRAM,
+	"Vcf":           VCF,
+	"Features":      Features,
+	"Reference":     FastaRef,
+	"GFFAnnotation": GffRef,
+}
+
+//AccessPolicy Maps OIDC roles and groups to the datasets and object groups they may access
+//If the policy is disabled every logged in user can access everything
+type AccessPolicy struct {
+	Enabled bool
+	Rules   []AccessRule
+	//Public Anonymous users can access all datasets that are not private
+	Public bool
+	//PrivateDatasets Keys of the Datasets config section that require a login in public mode
+	PrivateDatasets []string
+	//AdminRoles Users with one of the roles may change the dashboard data, e.g. upload sample sheets
+	AdminRoles []string
+}
+
+//AccessRule Grants access to datasets and object groups to all users with one of the roles or groups
+type AccessRule struct {
+	Roles  []string
+	Groups []string
+	//Datasets Keys of the Datasets config section, e.g. Bam, or * for all datasets
+	Datasets []string
+	//ObjectGroups IDs of single object groups that can be accessed without access to their dataset
+	ObjectGroups []string
+}
+
+//Permissions Datasets and object groups a single user may access
+type Permissions struct {
+	allowAll     bool
+	datasets     map[TrackType]bool
+	objectGroups map[string]bool
+}
+
+//ForbiddenError Returned if a user requests a dataset or object group that is not permitted
+type ForbiddenError struct {
+	TrackType     TrackType
+	ObjectGroupID string
+}
+
+func (err *ForbiddenError) Error() string {
+	if err.ObjectGroupID != "" {
+		return fmt.Sprintf("access to object group %v of dataset %v is forbidden", err.ObjectGroupID, err.TrackType)
+	}
+	return fmt.Sprintf("access to dataset %v is forbidden", err.TrackType)
+}
+
+//NewAccessPolicyFromConfig Reads the access policy from the Access config section
+func NewAccessPolicyFromConfig() (*AccessPolicy, error) {
+	var policy AccessPolicy
+	err := viper.UnmarshalKey("Access", &policy)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rule := range policy.Rules {
+		for _, dataset := range rule.Datasets {
+			if _, ok := datasetConfigKeys[dataset]; !ok && dataset != "*" {
+				return nil, fmt.Errorf("unknown dataset in access rule: %v", dataset)
+			}
+		}
+	}
+
+	policy.Public = viper.GetBool("Public.Enabled")
+	policy.PrivateDatasets = viper.GetStringSlice("Public.PrivateDatasets")
+
+	for _, dataset := range policy.PrivateDatasets {
+		if _, ok := datasetConfigKeys[dataset]; !ok {
+			return nil, fmt.Errorf("unknown private dataset: %v", dataset)
+		}
+	}
+
+	return &policy, nil
+}
+
+//AllowAllPermissions Returns permissions that grant access to everything
+func AllowAllPermissions() *Permissions {
+	return &Permissions{allowAll: true}
+}
+
+//PermissionsFor Collects the permissions of all rules that match the roles or groups of the user
+//In public mode anonymous users, i.e. a nil user, can access all datasets that are not private
+func (policy *AccessPolicy) PermissionsFor(user *UserInfo) *Permissions {
+	if user == nil && policy.Public {
+		return policy.publicPermissions()
+	}
+
+	if !policy.Enabled {
+		return AllowAllPermissions()
+	}
+
+	permissions := Permissions{
+		datasets:     make(map[TrackType]bool),
+		objectGroups: make(map[string]bool),
+	}
+
+	if user == nil {
+		return &permissions
+	}
+
+	//Logged in users can access at least what is public
+	if policy.Public {
+		permissions.datasets = policy.publicPermissions().datasets
+	}
+
+	for _, rule := range policy.Rules {
+		if !rule.matches(user) {
+			continue
+		}
+
+		for _, dataset := range rule.Datasets {
+			if dataset == "*" {
+				permissions.allowAll = true
+				continue
+			}
+			permissions.datasets[datasetConfigKeys[dataset]] = true
+		}
+
+		for _, objectGroup := range rule.ObjectGroups {
+			permissions.objectGroups[objectGroup] = true
+		}
+	}
+
+	return &permissions
+}
+
+func (policy *AccessPolicy) publicPermissions() *Permissions {
+	permissions := Permissions{
+		datasets:     make(map[TrackType]bool),
+		objectGroups: make(map[string]bool),
+	}
+
+	for key, trackType := range datasetConfigKeys {
+		permissions.datasets[trackType] = !containsAny([]string{key}, policy.PrivateDatasets)
+	}
+
+	return &permissions
+}
+
+//IsAdmin Returns true if the user has one of the admin roles, independent of Access.Enabled
+func (policy *AccessPolicy) IsAdmin(user *UserInfo) bool {
+	return user != nil && containsAny(policy.AdminRoles, user.Roles)
+}
+
+func (rule *AccessRule) matches(user *UserInfo) bool {
+	return containsAny(rule.Roles, user.Roles) || containsAny(rule.Groups, user.Groups)
+}
+
+//AllowsDataset Returns true if the whole dataset can be accessed
+func (permissions *Permissions) AllowsDataset(trackType TrackType) bool {
+	return permissions.allowAll || permissions.datasets[trackType]
+}
+
+//AllowsObjectGroup Returns true if the object group of the dataset can be accessed
+func (permissions *Permissions) AllowsObjectGroup(trackType TrackType, groupID string) bool {
+	return permissions.AllowsDataset(trackType) || permissions.objectGroups[groupID]
+}
+
+//AllowsAnyObjectGroup Returns true if at least a part of the dataset might be accessed
+func (permissions *Permissions) AllowsAnyObjectGroup(trackType TrackType) bool {
+	return permissions.AllowsDataset(trackType) || len(permissions.objectGroups) > 0
+}
+
+//auditForbidden Writes an audit log entry for a forbidden request
+func auditForbidden(c *gin.Context, err *ForbiddenError) {
+	subject := "anonymous"
+	if user := UserFromGinContext(c); user != nil {
+		subject = fmt.Sprintf("%v (%v)", user.Subject, user.Email)
+	}
+
+	log.Println(fmt.Sprintf("AUDIT forbidden: user=%v method=%v path=%v dataset=%v objectgroup=%v", subject, c.Request.Method, c.Request.URL.Path, err.TrackType, err.ObjectGroupID))
+}
+
+func containsAny(values []string, candidates []string) bool {
+	for _, value := range values {
+		for _, candidate := range candidates {
+			if value == candidate {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -2,26 +2,53 @@ package server
 
 import (
 	"context"
-	"encoding/base64"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"net/url"
 	"os"
+	"strings"
 
 	"github.com/ag-computational-bio/BioDataDBModels/go/client"
 
+	"github.com/coreos/go-oidc"
 	"github.com/gin-gonic/gin"
 	"github.com/spf13/viper"
 	"golang.org/x/oauth2"
 	"google.golang.org/grpc/metadata"
 )
 
+const (
+	//sessionCookie Name of the cookie that stores the session id
+	sessionCookie = "session"
+	//tokenContextKey Key of the current oauth2 token in the gin context
+	tokenContextKey = "token"
+)
+
+var errNotLoggedIn = errors.New("no valid session found")
+
+//publicPaths Paths that can be accessed without being logged in
+var publicPaths = map[string]bool{
+	"/login":         true,
+	"/auth/callback": true,
+	"/logout":        true,
+}
+
 //AuthHandler Basic for performing authentication
 type AuthHandler struct {
-	Oauth2Conf        *oauth2.Config
-	Oauth2StateString string
+	Oauth2Conf *oauth2.Config
+	//CookieSecret Key used to sign the login state cookie
+	CookieSecret []byte
+	//TokenStrategy Decides if the token of the user or the service is used for backend calls
+	TokenStrategy TokenStrategy
+	//ServiceToken BioDataDB api token of the service
+	ServiceToken string
+	//Sessions Server side sessions of the logged in users
+	Sessions *SessionManager
+	//OIDCVerifier Verifies the id tokens returned by the login
+	OIDCVerifier *OIDCVerifier
+	//PublicMode Login is optional, all reads use the service token
+	PublicMode bool
 }
 
 // Init Initializes the auth handler object
@@ -30,6 +57,8 @@ func (handler *AuthHandler) Init() {
 	callbackURL := viper.GetString("Auth.CallbackURL")
 	AuthURL := viper.GetString("Auth.AuthURL")
 	TokenURL := viper.GetString("Auth.TokenURL")
+	issuerURL := viper.GetString("Auth.URL")
+	userInfoURL := viper.GetString("Auth.UserInfoURL")
 
 	oauth2Conf := &oauth2.Config{
 		ClientID:     clientID,
@@ -39,45 +68,104 @@ func (handler *AuthHandler) Init() {
 			AuthURL:  AuthURL,
 			TokenURL: TokenURL,
 		},
-		Scopes: []string{"profile", "email"},
+		Scopes: []string{oidc.ScopeOpenID, "profile", "email"},
 	}
 	handler.Oauth2Conf = oauth2Conf
 
-	//TODO change
-	handler.Oauth2StateString = "test"
+	handler.OIDCVerifier = &OIDCVerifier{
+		IssuerURL:   issuerURL,
+		ClientID:    clientID,
+		UserInfoURL: userInfoURL,
+	}
+
+	//The secret has to be shared between all replicas, otherwise logins fail if the callback hits another replica
+	cookieSecret := os.Getenv("CookieSecret")
+	if cookieSecret == "" {
+		log.Println("CookieSecret not set, using a random secret for this instance")
+		randomSecret, err := randomString(32)
+		if err != nil {
+			log.Fatalln(err.Error())
+		}
+		cookieSecret = randomSecret
+	}
+	handler.CookieSecret = []byte(cookieSecret)
+
+	tokenStrategy, err := parseTokenStrategy(viper.GetString("Auth.TokenStrategy"))
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+
+	//Anonymous users have no token, so the service token is used for everyone
+	handler.PublicMode = viper.GetBool("Public.Enabled")
+	if handler.PublicMode {
+		tokenStrategy = ServiceTokenStrategy
+	}
+	handler.TokenStrategy = tokenStrategy
+	handler.ServiceToken = os.Getenv("APIToken")
+
+	if tokenStrategy != UserTokenStrategy && handler.ServiceToken == "" {
+		log.Fatalln(fmt.Sprintf("APIToken needs to be set for token strategy: %v", tokenStrategy))
+	}
+
+	sessions, err := NewSessionManagerFromConfig()
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+	handler.Sessions = sessions
 }
 
 // Callback callback handling for oauth2 login
 func (handler *AuthHandler) Callback(c *gin.Context) {
-	state := c.Query("state")
-	code := c.Query("code")
+	if errorCode := c.Query("error"); errorCode != "" {
+		log.Println(fmt.Sprintf("login failed at identity provider: %v %v", errorCode, c.Query("error_description")))
+		renderAuthError(c, http.StatusUnauthorized, "The login was rejected by the identity provider.")
+		return
+	}
+
+	state, err := handler.popLoginState(c, c.Query("state"))
+	if err != nil {
+		log.Println(err.Error())
+		switch err {
+		case errLoginStateMissing:
+			renderAuthError(c, http.StatusBadRequest, "No login in progress was found. Please make sure that cookies are enabled and start the login again.")
+		case errLoginStateExpired:
+			renderAuthError(c, http.StatusBadRequest, "The login took too long and has expired. Please start the login again.")
+		default:
+			renderAuthError(c, http.StatusBadRequest, "The login request could not be verified. Please start the login again.")
+		}
+		return
+	}
 
-	token, err := handler.GetAccessToken(state, code)
+	token, err := handler.GetAccessToken(c.Query("code"), state.CodeVerifier)
 	if err != nil {
 		log.Println(err.Error())
-		c.AbortWithError(400, err)
+		renderAuthError(c, http.StatusBadGateway, "The login could not be completed. Please try again later.")
+		return
 	}
 
-	marshalledToken, err := json.Marshal(token)
+	user, err := handler.OIDCVerifier.VerifyToken(c.Request.Context(), handler.Oauth2Conf, token)
 	if err != nil {
 		log.Println(err.Error())
-		c.AbortWithError(400, err)
+		renderAuthError(c, http.StatusUnauthorized, "The identity returned by the login could not be verified. Please start the login again.")
+		return
 	}
 
-	tokenString := base64.StdEncoding.EncodeToString(marshalledToken)
+	session, err := handler.Sessions.Create(token, user)
+	if err != nil {
+		log.Println(err.Error())
+		c.AbortWithError(500, err)
+		return
+	}
 
-	c.SetCookie("token", tokenString, 15*60*60, "/", "", true, true)
+	handler.setSessionCookie(c, session)
 
 	c.Redirect(http.StatusMovedPermanently, "/index")
 	c.Abort()
 }
 
-// GetAccessToken Returns the token of a login request
-func (handler *AuthHandler) GetAccessToken(state string, code string) (*oauth2.Token, error) {
-	if state != handler.Oauth2StateString {
-		return nil, fmt.Errorf("invalid oauth state")
-	}
-	token, err := handler.Oauth2Conf.Exchange(oauth2.NoContext, code)
+// GetAccessToken Exchanges the code of a login request for a token, using the PKCE code verifier of the login
+func (handler *AuthHandler) GetAccessToken(code string, codeVerifier string) (*oauth2.Token, error) {
+	token, err := handler.Oauth2Conf.Exchange(context.TODO(), code, oauth2.SetAuthURLParam("code_verifier", codeVerifier))
 	if err != nil {
 		return nil, fmt.Errorf("code exchange failed: %s", err.Error())
 	}
@@ -85,116 +173,183 @@ func (handler *AuthHandler) GetAccessToken(state string, code string) (*oauth2.T
 }
 
 // Auth Used to authenticate call and login
+// Every login gets its own random state and PKCE code verifier
 func (handler *AuthHandler) Auth(c *gin.Context) {
-	c.Redirect(http.StatusMovedPermanently, handler.Oauth2Conf.AuthCodeURL(handler.Oauth2StateString, oauth2.AccessTypeOffline))
+	state, err := newLoginState()
+	if err != nil {
+		log.Println(err.Error())
+		c.AbortWithError(500, err)
+		return
+	}
+
+	err = handler.setLoginStateCookie(c, state)
+	if err != nil {
+		log.Println(err.Error())
+		c.AbortWithError(500, err)
+		return
+	}
+
+	authURL := handler.Oauth2Conf.AuthCodeURL(
+		state.State,
+		oauth2.AccessTypeOffline,
+		oauth2.SetAuthURLParam("code_challenge", state.codeChallenge()),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	)
+
+	//Must not be a permanent redirect, browsers would cache the state
+	c.Redirect(http.StatusFound, authURL)
+	c.Abort()
+}
+
+//renderAuthError Shows an error page for a failed login
+func renderAuthError(c *gin.Context, status int, message string) {
+	c.HTML(status, "autherror.html", gin.H{"Message": message})
 	c.Abort()
 }
 
-//UpdateToken Updates the token if available
+//UpdateToken Refreshes the token of the session if required and stores the refreshed token in the session
+//Requests without a valid session are redirected to the login
 func (handler *AuthHandler) UpdateToken(c *gin.Context) {
-	if c.Request.URL.Path == "/login" || c.Request.URL.Path == "/auth/callback" {
-		c.Next()
+	if publicPaths[c.Request.URL.Path] {
+		return
 	}
 
-	rawTokenCookie, err := c.Request.Cookie("token")
-	if err != nil {
+	err := handler.refreshSession(c)
+	//The requests of the browser to the data endpoints can not follow the redirect to the login
+	if err == errNotLoggedIn && strings.HasPrefix(c.Request.URL.Path, "/data/") {
+		abortWithDataError(c, err)
+		return
+	}
+	if err == errNotLoggedIn {
 		c.Redirect(http.StatusTemporaryRedirect, "/login")
+		c.Abort()
 		return
 	}
 
-	token := decodeToken(rawTokenCookie, c)
-
-	tokensource := handler.Oauth2Conf.TokenSource(context.TODO(), token)
-	updatedToken, err := tokensource.Token()
 	if err != nil {
 		log.Println(err.Error())
-		c.Redirect(http.StatusTemporaryRedirect, "/login")
-		c.Abort()
+		c.AbortWithError(500, err)
+		return
+	}
+
+	c.Next()
+}
+
+//OptionalSession Loads and refreshes the session if the user is logged in, anonymous requests are passed on
+//Used instead of UpdateToken in public mode
+func (handler *AuthHandler) OptionalSession(c *gin.Context) {
+	err := handler.refreshSession(c)
+	if err != nil && err != errNotLoggedIn {
+		log.Println(err.Error())
+	}
+
+	c.Next()
+}
+
+//refreshSession Loads the session of the request, refreshes its token and stores token and user in the gin context
+//Returns errNotLoggedIn if there is no valid session, invalid sessions are removed
+func (handler *AuthHandler) refreshSession(c *gin.Context) error {
+	session, err := handler.sessionFromGinContext(c)
+	if err == http.ErrNoCookie {
+		return errNotLoggedIn
+	}
+
+	if err != nil {
+		if err != errSessionNotFound {
+			log.Println(err.Error())
+		}
+		clearSessionCookie(c)
+		return errNotLoggedIn
 	}
 
-	updatedRawToken, err := json.Marshal(updatedToken)
+	tokensource := handler.Oauth2Conf.TokenSource(c.Request.Context(), session.Token)
+	updatedToken, err := tokensource.Token()
 	if err != nil {
 		log.Println(err.Error())
-		c.Redirect(http.StatusTemporaryRedirect, "/index")
-		c.AbortWithError(400, err)
+		handler.revokeSession(c, session.ID)
+		return errNotLoggedIn
 	}
 
-	rawTokenCookie.Value = string(updatedRawToken)
+	if updatedToken.AccessToken != session.Token.AccessToken {
+		err = handler.Sessions.UpdateToken(session, updatedToken)
+		if err != nil {
+			return err
+		}
+	}
 
-	c.Next()
+	c.Set(tokenContextKey, updatedToken)
+	c.Set(userContextKey, session.User)
+
+	return nil
+}
+
+//Logout Revokes the session of the user
+func (handler *AuthHandler) Logout(c *gin.Context) {
+	sessionID, err := c.Cookie(sessionCookie)
+	if err == nil {
+		handler.revokeSession(c, sessionID)
+	}
+
+	c.HTML(200, "logout.html", gin.H{})
 }
 
 // OutGoingContextFromToken Creates the required outgoing context for a call
-func (handler *AuthHandler) OutGoingContextFromToken(token string, tokentype client.TokenType) context.Context {
+func (handler *AuthHandler) OutGoingContextFromToken(ctx context.Context, token string, tokentype client.TokenType) context.Context {
 	mdMap := make(map[string]string)
 	mdMap[string(tokentype)] = token
 	tokenMetadata := metadata.New(mdMap)
 
-	outgoingContext := metadata.NewOutgoingContext(context.TODO(), tokenMetadata)
+	outgoingContext := metadata.NewOutgoingContext(ctx, tokenMetadata)
 	return outgoingContext
 }
 
-// GetAccessTokenFromGinContext Returns the access token of a gin context from cookie
-// Token needs to be stored as "token"
+// GetAccessTokenFromGinContext Returns the access token of a gin context
+// The token refreshed by UpdateToken is preferred over the token stored in the session
 func (handler *AuthHandler) GetAccessTokenFromGinContext(c *gin.Context) string {
-	rawTokenCookie, err := c.Request.Cookie("token")
-	if err != nil && err != http.ErrNoCookie {
-		log.Println(err.Error())
-		c.AbortWithError(400, err)
+	if token, ok := c.Get(tokenContextKey); ok {
+		return token.(*oauth2.Token).AccessToken
 	}
 
-	if err == http.ErrNoCookie {
-		log.Println("cookie not found")
+	session, err := handler.sessionFromGinContext(c)
+	if err == http.ErrNoCookie || err == errSessionNotFound {
+		log.Println("session not found")
 		return ""
 	}
 
-	unescapedBase64Data, err := url.QueryUnescape(rawTokenCookie.Value)
-	if err != nil {
-		log.Println(err.Error())
-		c.Redirect(http.StatusTemporaryRedirect, "/index")
-		c.AbortWithError(400, err)
-	}
-
-	rawBytesDecoded, err := base64.StdEncoding.DecodeString(unescapedBase64Data)
 	if err != nil {
 		log.Println(err.Error())
-		c.Redirect(http.StatusTemporaryRedirect, "/index")
-		c.AbortWithError(400, err)
+		c.AbortWithError(500, err)
+		return ""
 	}
 
-	var token oauth2.Token
+	return session.Token.AccessToken
+}
 
-	err = json.Unmarshal([]byte(rawBytesDecoded), &token)
+//sessionFromGinContext Loads the session referenced by the session cookie
+func (handler *AuthHandler) sessionFromGinContext(c *gin.Context) (*Session, error) {
+	sessionID, err := c.Cookie(sessionCookie)
 	if err != nil {
-		log.Println(err.Error())
-		c.AbortWithError(400, err)
+		return nil, err
 	}
 
-	return token.AccessToken
+	return handler.Sessions.Load(sessionID)
 }
 
-func decodeToken(rawTokenCookie *http.Cookie, c *gin.Context) *oauth2.Token {
-	unescapedBase64Data, err := url.QueryUnescape(rawTokenCookie.Value)
-	if err != nil {
-		log.Println(err.Error())
-		c.Redirect(http.StatusTemporaryRedirect, "/index")
-		c.AbortWithError(400, err)
-	}
+//setSessionCookie Stores the opaque session id in the "session" cookie
+func (handler *AuthHandler) setSessionCookie(c *gin.Context, session *Session) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(sessionCookie, session.ID, int(handler.Sessions.AbsoluteTimeout.Seconds()), "/", "", true, true)
+}
 
-	rawBytesDecoded, err := base64.StdEncoding.DecodeString(unescapedBase64Data)
+//revokeSession Deletes the session from the store and the cookie from the browser
+func (handler *AuthHandler) revokeSession(c *gin.Context, sessionID string) {
+	err := handler.Sessions.Revoke(sessionID)
 	if err != nil {
 		log.Println(err.Error())
-		c.Redirect(http.StatusTemporaryRedirect, "/index")
-		c.AbortWithError(400, err)
-	}
-
-	var token oauth2.Token
-	err = json.Unmarshal(rawBytesDecoded, &token)
-	if err != nil && err != http.ErrNoCookie {
-		log.Println(err.Error())
-		c.Redirect(http.StatusTemporaryRedirect, "/index")
-		c.AbortWithError(400, err)
 	}
+	clearSessionCookie(c)
+}
 
-	return &token
+func clearSessionCookie(c *gin.Context) {
+	c.SetCookie(sessionCookie, "", -1, "/", "", true, true)
 }
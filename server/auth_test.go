@@ -0,0 +1,196 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+)
+
+//newTestTokenServer Fake token endpoint that answers refresh requests with refreshedToken or fails if it is empty
+func newTestTokenServer(t *testing.T, refreshedToken string, requests *int32) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+
+		err := r.ParseForm()
+		if err != nil || r.Form.Get("grant_type") != "refresh_token" {
+			t.Errorf("unexpected token request: %v", r.Form)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if refreshedToken == "" {
+			w.WriteHeader(400)
+			w.Write([]byte(`{"error": "invalid_grant"}`))
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  refreshedToken,
+			"token_type":    "Bearer",
+			"refresh_token": "refresh-2",
+			"expires_in":    300,
+		})
+	}))
+}
+
+func TestUpdateToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name           string
+		path           string
+		token          *oauth2.Token
+		refreshedToken string
+		wantStatus     int
+		wantLocation   string
+		wantToken      string
+		wantRequests   int32
+		wantRevoked    bool
+	}{
+		{
+			name:       "valid token",
+			path:       "/browser/",
+			token:      &oauth2.Token{AccessToken: "access-1", RefreshToken: "refresh-1", Expiry: time.Now().Add(time.Hour)},
+			wantStatus: 200,
+			wantToken:  "access-1",
+		},
+		{
+			name:           "expired token is refreshed and stored",
+			path:           "/browser/",
+			token:          &oauth2.Token{AccessToken: "access-1", RefreshToken: "refresh-1", Expiry: time.Now().Add(-time.Minute)},
+			refreshedToken: "access-2",
+			wantStatus:     200,
+			wantToken:      "access-2",
+			wantRequests:   1,
+		},
+		{
+			name:         "failed refresh revokes the session",
+			path:         "/browser/",
+			token:        &oauth2.Token{AccessToken: "access-1", RefreshToken: "refresh-1", Expiry: time.Now().Add(-time.Minute)},
+			wantStatus:   http.StatusTemporaryRedirect,
+			wantLocation: "/login",
+			wantRequests: 1,
+			wantRevoked:  true,
+		},
+		{
+			name:         "data request with failed refresh gets a JSON error",
+			path:         "/data/genomes/NC_002942/default",
+			token:        &oauth2.Token{AccessToken: "access-1", RefreshToken: "refresh-1", Expiry: time.Now().Add(-time.Minute)},
+			wantStatus:   401,
+			wantRequests: 1,
+			wantRevoked:  true,
+		},
+		{
+			name:         "page request without session",
+			path:         "/browser/",
+			wantStatus:   http.StatusTemporaryRedirect,
+			wantLocation: "/login",
+		},
+		{
+			name:       "data request without session",
+			path:       "/data/genomes/NC_002942/default",
+			wantStatus: 401,
+		},
+		{
+			name:       "public path without session",
+			path:       "/logout",
+			wantStatus: 200,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var requests int32
+			tokenServer := newTestTokenServer(t, test.refreshedToken, &requests)
+			defer tokenServer.Close()
+
+			handler := AuthHandler{
+				Oauth2Conf: &oauth2.Config{
+					ClientID: "dashboard",
+					Endpoint: oauth2.Endpoint{TokenURL: tokenServer.URL, AuthStyle: oauth2.AuthStyleInParams},
+				},
+				Sessions: &SessionManager{
+					Store:           NewMemorySessionStore(),
+					IdleTimeout:     time.Hour,
+					AbsoluteTimeout: time.Hour,
+				},
+			}
+
+			router := gin.New()
+			router.Use(RequestID, handler.UpdateToken)
+			router.GET("/*path", func(c *gin.Context) {
+				c.String(200, handler.GetAccessTokenFromGinContext(c))
+			})
+
+			request := httptest.NewRequest("GET", test.path, nil)
+
+			var session *Session
+			if test.token != nil {
+				var err error
+				session, err = handler.Sessions.Create(test.token, &UserInfo{Subject: "user"})
+				if err != nil {
+					t.Fatal(err)
+				}
+				request.AddCookie(&http.Cookie{Name: sessionCookie, Value: session.ID})
+			}
+
+			response := httptest.NewRecorder()
+			router.ServeHTTP(response, request)
+
+			if response.Code != test.wantStatus {
+				t.Fatalf("got status %v, want %v: %v", response.Code, test.wantStatus, response.Body.String())
+			}
+			if location := response.Header().Get("Location"); location != test.wantLocation {
+				t.Errorf("got location %q, want %q", location, test.wantLocation)
+			}
+			if requests != test.wantRequests {
+				t.Errorf("got %v token requests, want %v", requests, test.wantRequests)
+			}
+
+			if test.wantToken != "" {
+				if body := response.Body.String(); body != test.wantToken {
+					t.Errorf("got token %q in the request, want %q", body, test.wantToken)
+				}
+
+				stored, err := handler.Sessions.Store.Get(session.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if stored.Token.AccessToken != test.wantToken {
+					t.Errorf("got token %q in the session, want %q", stored.Token.AccessToken, test.wantToken)
+				}
+			}
+
+			if test.wantRevoked {
+				_, err := handler.Sessions.Store.Get(session.ID)
+				if err != errSessionNotFound {
+					t.Errorf("session was not revoked: %v", err)
+				}
+
+				cookie := response.Header().Get("Set-Cookie")
+				if !strings.HasPrefix(cookie, sessionCookie+"=;") || !strings.Contains(cookie, "Max-Age=0") {
+					t.Errorf("session cookie was not cleared: %q", cookie)
+				}
+			}
+
+			if strings.HasPrefix(test.path, "/data/") && test.wantStatus == 401 {
+				var body ErrorResponse
+				err := json.Unmarshal(response.Body.Bytes(), &body)
+				if err != nil {
+					t.Fatalf("no JSON error body: %v", response.Body.String())
+				}
+				if body.Error.Code != "unauthorized" || body.Error.RequestID == "" {
+					t.Errorf("got error body %+v", body.Error)
+				}
+			}
+		})
+	}
+}
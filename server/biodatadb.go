@@ -0,0 +1,208 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"log"
+	"net"
+
+	"github.com/ag-computational-bio/BioDataDBModels/go/api"
+	"github.com/ag-computational-bio/BioDataDBModels/go/client"
+	"github.com/ag-computational-bio/BioDataDBModels/go/commonmodels"
+	"github.com/ag-computational-bio/BioDataDBModels/go/datasetapimodels"
+	"github.com/ag-computational-bio/BioDataDBModels/go/datasetentrymodels"
+	"github.com/ag-computational-bio/BioDataDBModels/go/loadmodels"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+//BioDataDBSource TrackSource that reads datasets from the BioDataDB gRPC API
+type BioDataDBSource struct {
+	GRPCEndpoints client.GRPCEndpointsClients
+	//Conn Connection of the endpoint clients, used to check the connectivity
+	Conn       *grpc.ClientConn
+	AutHandler AuthHandler
+	Calls      *CallPolicy
+}
+
+//NewBioDataDBSource Connects to the BioDataDB API, the connection is established in the background
+//Same as client.GRPCEndpointsClients.New, but the connection is kept for the readiness check
+func NewBioDataDBSource(host string, port string, authhandler AuthHandler, calls *CallPolicy) (*BioDataDBSource, error) {
+	dialOption := grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{}))
+	if host == "localhost" {
+		dialOption = grpc.WithInsecure()
+	}
+
+	conn, err := grpc.Dial(net.JoinHostPort(host, port), dialOption)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	return &BioDataDBSource{
+		GRPCEndpoints: client.GRPCEndpointsClients{
+			DatasetBackend:         api.NewDatasetServiceClient(conn),
+			ProjectBackend:         api.NewProjectAPIClient(conn),
+			LoadBackend:            api.NewLoadServiceClient(conn),
+			TokenBackend:           api.NewAPITokenServiceClient(conn),
+			ObjectsBackend:         api.NewObjectsServiceClient(conn),
+			GenericOutGoingContext: context.Background(),
+		},
+		Conn:       conn,
+		AutHandler: authhandler,
+		Calls:      calls,
+	}, nil
+}
+
+//GetCurrentDatasetVersion Returns the current version of a dataset
+func (source *BioDataDBSource) GetCurrentDatasetVersion(ctx context.Context, datasetID string, credentials Credentials) (*DatasetVersion, error) {
+	id := commonmodels.ID{
+		ID: datasetID,
+	}
+
+	var datasetVersion *datasetentrymodels.DatasetVersionEntry
+	err := source.Calls.call(ctx, "GetCurrentVersionOfDataset", func(ctx context.Context) error {
+		var err error
+		datasetVersion, err = source.GRPCEndpoints.DatasetBackend.GetCurrentVersionOfDataset(source.AutHandler.OutGoingContextFromToken(ctx, credentials.Token, credentials.TokenType), &id)
+		return err
+	})
+	if err != nil {
+		err := backendError(err, "dataset", datasetID)
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	return &DatasetVersion{
+		ID:        datasetVersion.GetID(),
+		DatasetID: datasetVersion.GetDatasetID(),
+	}, nil
+}
+
+//GetDatasetObjectGroups Returns all object groups of a specific dataset version
+func (source *BioDataDBSource) GetDatasetObjectGroups(ctx context.Context, datasetVersion *DatasetVersion, credentials Credentials) ([]*ObjectGroup, error) {
+	datasetVersionID := commonmodels.ID{
+		ID: datasetVersion.ID,
+	}
+
+	var datasetObjects *datasetapimodels.DatasetObjectGroupList
+	err := source.Calls.call(ctx, "DatasetVersionObjectGroups", func(ctx context.Context) error {
+		var err error
+		datasetObjects, err = source.GRPCEndpoints.DatasetBackend.DatasetVersionObjectGroups(source.AutHandler.OutGoingContextFromToken(ctx, credentials.Token, credentials.TokenType), &datasetVersionID)
+		return err
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	var groups []*ObjectGroup
+	for _, objectGroup := range datasetObjects.GetDatasetObjectGroups() {
+		groups = append(groups, objectGroupFromEntry(objectGroup, nil))
+	}
+
+	return groups, nil
+}
+
+//GetDatasetDownloadLinks Returns presigned download urls for all object groups of a specific dataset version
+func (source *BioDataDBSource) GetDatasetDownloadLinks(ctx context.Context, datasetVersion *DatasetVersion, credentials Credentials) ([]*ObjectGroup, error) {
+	groupLinks, err := source.getDownloadLinks(ctx, commonmodels.Resource_DatasetVersion, datasetVersion.ID, credentials)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	var groups []*ObjectGroup
+	for _, link := range groupLinks.GetLinks() {
+		groups = append(groups, objectGroupFromEntry(link.GetObject(), link.GetLink()))
+	}
+
+	return groups, nil
+}
+
+//GetObjectGroup Returns presigned download urls for a specific object group
+func (source *BioDataDBSource) GetObjectGroup(ctx context.Context, groupID string, credentials Credentials) (*ObjectGroup, error) {
+	groupLinks, err := source.getDownloadLinks(ctx, commonmodels.Resource_DatasetObjectGroupResource, groupID, credentials)
+	if err != nil {
+		err := backendError(err, "object group", groupID)
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	if len(groupLinks.GetLinks()) < 1 {
+		err := &NotFoundError{Resource: "object group", ID: groupID}
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	link := groupLinks.GetLinks()[0]
+
+	return objectGroupFromEntry(link.GetObject(), link.GetLink()), nil
+}
+
+func (source *BioDataDBSource) getDownloadLinks(ctx context.Context, resource commonmodels.Resource, resourceID string, credentials Credentials) (*loadmodels.GetDownloadResponse, error) {
+	var requests []*loadmodels.ResourceRequest
+
+	requests = append(requests, &loadmodels.ResourceRequest{
+		Resource:   resource,
+		ResourceID: resourceID,
+	})
+
+	downloadRequest := loadmodels.GetDownloadRequest{
+		Resource: requests,
+	}
+
+	var downloadLinks *loadmodels.GetDownloadResponse
+	err := source.Calls.call(ctx, "GetDownloadLinks", func(ctx context.Context) error {
+		var err error
+		downloadLinks, err = source.GRPCEndpoints.LoadBackend.GetDownloadLinks(source.AutHandler.OutGoingContextFromToken(ctx, credentials.Token, credentials.TokenType), &downloadRequest)
+		return err
+	})
+
+	return downloadLinks, err
+}
+
+//backendError Converts the gRPC errors of the BioDataDB that refer to a dataset or object group into typed errors
+func backendError(err error, resource string, id string) error {
+	switch status.Code(err) {
+	case codes.NotFound:
+		return &NotFoundError{Resource: resource, ID: id}
+	case codes.InvalidArgument:
+		if resource == "dataset" {
+			return &InvalidDatasetError{DatasetID: id, Reason: status.Convert(err).Message()}
+		}
+	}
+
+	return err
+}
+
+//objectGroupFromEntry Converts a BioDataDB object group, links are matched to the objects by their index
+func objectGroupFromEntry(entry *datasetentrymodels.DatasetObjectGroup, links []string) *ObjectGroup {
+	group := ObjectGroup{
+		ID:        entry.GetID(),
+		Name:      entry.GetName(),
+		DatasetID: entry.GetDatasetID(),
+		Objects:   make([]*Object, 0),
+	}
+
+	//Attributes of the group take precedence over the attributes of its objects
+	group.Attributes = attributesFromStruct(entry.GetAdditionalMetadata(), nil)
+
+	for i, objectEntry := range entry.GetObjects() {
+		group.Attributes = attributesFromStruct(objectEntry.GetAdditionalMetadata(), group.Attributes)
+
+		object := Object{
+			ID:       objectEntry.GetID(),
+			Filename: objectEntry.GetFilename(),
+		}
+
+		if i < len(links) {
+			object.URL = links[i]
+		}
+
+		group.Objects = append(group.Objects, &object)
+	}
+
+	return &group
+}
@@ -3,9 +3,7 @@ package server
 import (
 	"context"
 	"log"
-	"os"
 
-	"github.com/ag-computational-bio/BioDataDBModels/go/client"
 	"github.com/gin-gonic/gin"
 )
 
@@ -13,6 +11,7 @@ import (
 type BrowserEndpoints struct {
 	DataHandler DataHandler
 	AutHandler  AuthHandler
+	Access      *AccessPolicy
 	Token       string
 }
 
@@ -30,137 +29,252 @@ type ID struct {
 	ID string `uri:"id" binding:"required"`
 }
 
-//GetDefaultTrackConfig
-func (browser *BrowserEndpoints) GetDefaultTrackConfig(c *gin.Context) {
-	token := browser.AutHandler.GetAccessTokenFromGinContext(c)
-
-	token = os.Getenv("APIToken")
+//GenomeTrackID ID of an object group within a genome
+type GenomeTrackID struct {
+	Genome string `uri:"genome" binding:"required"`
+	ID     string `uri:"id" binding:"required"`
+}
 
-	currentRefFastaVersion, err := browser.DataHandler.getCurrentDatasetVersion(FastaRef, token)
-	if err != nil {
-		log.Println(err.Error())
-		c.AbortWithError(400, err)
+//GetDefaultTrackConfig Returns the igv.js browser config with the reference and annotation of a genome
+func (browser *BrowserEndpoints) GetDefaultTrackConfig(c *gin.Context) {
+	genome, ok := browser.DataHandler.GetGenome(c.Param("genome"))
+	if !ok {
+		abortWithDataError(c, &NotFoundError{Resource: "genome", ID: c.Param("genome")})
 		return
 	}
 
-	refFiles, err := browser.DataHandler.getDatasetDownloadLinks(currentRefFastaVersion, token)
+	credentials, err := browser.AutHandler.CredentialsFromGinContext(c)
 	if err != nil {
-		log.Println(err.Error())
-		c.AbortWithError(400, err)
+		abortWithDataError(c, err)
 		return
 	}
 
-	currentAnnotationGffVersion, err := browser.DataHandler.getCurrentDatasetVersion(GffRef, token)
+	browserConfig, err := browser.defaultBrowser(c.Request.Context(), genome, credentials, browser.Access.PermissionsFor(UserFromGinContext(c)))
 	if err != nil {
-		log.Println(err.Error())
-		c.AbortWithError(400, err)
+		abortWithDataError(c, err)
 		return
 	}
 
-	gffAnnotationFiles, err := browser.DataHandler.getDatasetDownloadLinks(currentAnnotationGffVersion, token)
-	if err != nil {
-		log.Println(err.Error())
-		c.AbortWithError(400, err)
-		return
+	c.JSON(200, browserConfig)
+
+}
+
+//defaultBrowser Returns the igv.js browser config of a genome without tracks
+func (browser *BrowserEndpoints) defaultBrowser(ctx context.Context, genome *Genome, credentials Credentials, permissions *Permissions) (*Browser, error) {
+	for _, trackType := range []TrackType{FastaRef, GffRef} {
+		if !permissions.AllowsDataset(trackType) {
+			return nil, &ForbiddenError{TrackType: trackType}
+		}
 	}
 
-	gffTrack := Track{
-		Type:       "annotation",
-		Format:     "gff3",
-		Name:       "Annotation",
-		AutoHeight: true,
-		Searchable: true,
-		URL:        gffAnnotationFiles.GetLinks()[0].GetLink()[0],
+	var fasta, fastaIndex *ClassifiedObject
+	fastaCall := datasetCall{
+		TrackType: FastaRef,
+		Call: func(ctx context.Context) error {
+			var err error
+			fasta, fastaIndex, err = browser.DataHandler.GetReferenceFasta(ctx, genome, credentials)
+			return err
+		},
+	}
+
+	var gffTrack Track
+	gffCall := datasetCall{
+		TrackType: GffRef,
+		Call: func(ctx context.Context) error {
+			var err error
+			gffTrack, err = browser.annotationTrack(ctx, genome, credentials)
+			return err
+		},
+	}
+
+	err := browser.DataHandler.runDatasetCalls(ctx, genome, fastaCall, gffCall)
+	if err != nil {
+		return nil, err
 	}
 
 	reference := Reference{
-		Name:     "NC_002942",
-		ID:       "NC_002942",
-		FastaURL: refFiles.GetLinks()[0].GetLink()[0],
-		IndexURL: refFiles.GetLinks()[0].GetLink()[1],
+		Name:     genome.Name,
+		ID:       genome.ID,
+		FastaURL: fasta.URL,
+		IndexURL: fastaIndex.URL,
 		Tracks:   []Track{gffTrack},
 	}
 
 	igv_browser := Browser{
-		ID:        "NC_002942",
-		Name:      "NC_002942",
+		ID:        genome.ID,
+		Name:      genome.Name,
 		Reference: reference,
 		Tracks:    make([]Track, 0),
 	}
 
-	c.JSON(200, igv_browser)
-
+	return &igv_browser, nil
 }
 
-func (browser *BrowserEndpoints) GetBigWigsTracks(c *gin.Context) {
-	var id ID
-	err := c.BindUri(&id)
+//annotationTrack Returns the GFF3 or GTF annotation track of a genome
+func (browser *BrowserEndpoints) annotationTrack(ctx context.Context, genome *Genome, credentials Credentials) (Track, error) {
+	currentAnnotationGffVersion, err := browser.DataHandler.getCurrentDatasetVersion(ctx, genome, GffRef, credentials)
 	if err != nil {
 		log.Println(err.Error())
-		c.AbortWithError(400, err)
-		return
+		return Track{}, err
 	}
 
-	token := browser.AutHandler.GetAccessTokenFromGinContext(c)
+	gffAnnotationFiles, err := browser.DataHandler.getDatasetDownloadLinks(ctx, currentAnnotationGffVersion, credentials)
+	if err != nil {
+		log.Println(err.Error())
+		return Track{}, err
+	}
 
-	token = os.Getenv("APIToken")
+	gffGroup, gffFile, err := browser.DataHandler.findDataFile(genome.datasetID(GffRef), gffAnnotationFiles, FormatGFF3, FormatGTF)
+	if err != nil {
+		return Track{}, err
+	}
 
-	tracks, err := browser.DataHandler.GetBigWigsTrack(id.ID, token)
+	gffTrack := Track{
+		Type:       "annotation",
+		Format:     string(gffFile.Format),
+		Name:       "Annotation",
+		AutoHeight: true,
+		Searchable: true,
+		URL:        gffFile.URL,
+	}
+
+	//Compressed annotations can be used with a tabix index
+	gffIndex, err := gffGroup.IndexFor(gffFile)
 	if err != nil {
-		log.Println(err.Error())
-		c.AbortWithError(400, err)
-		return
+		return Track{}, err
+	}
+	if gffIndex != nil {
+		gffTrack.IndexURL = gffIndex.URL
 	}
 
-	c.JSON(200, tracks)
+	return gffTrack, nil
+}
+
+//trackLoader Loads the tracks of an object group from the data handler
+type trackLoader func(ctx context.Context, genome *Genome, id string, credentials Credentials, permissions *Permissions) ([]Track, error)
+
+//GetBigWigsTracks Returns the bigwigs tracks of an object group
+func (browser *BrowserEndpoints) GetBigWigsTracks(c *gin.Context) {
+	browser.serveTracks(c, browser.DataHandler.GetBigWigsTrack)
 }
 
+//GetBamTrack Returns the bam track of an object group
 func (browser *BrowserEndpoints) GetBamTrack(c *gin.Context) {
-	var id ID
+	browser.serveTracks(c, browser.DataHandler.GetBamTrack)
+}
+
+//GetCramTrack Returns the cram track of an object group
+func (browser *BrowserEndpoints) GetCramTrack(c *gin.Context) {
+	browser.serveTracks(c, browser.DataHandler.GetCramTrack)
+}
+
+//GetFeaturesTrack Returns the bed, bedGraph and peak tracks of an object group
+func (browser *BrowserEndpoints) GetFeaturesTrack(c *gin.Context) {
+	browser.serveTracks(c, browser.DataHandler.GetFeaturesTrack)
+}
+
+//GetVcfTrack Returns the variant track of an object group
+//The INFO field used for coloring is set with the colorBy query parameter, the shown samples with sample query parameters
+func (browser *BrowserEndpoints) GetVcfTrack(c *gin.Context) {
+	options := VariantOptions{
+		ColorBy: c.Query("colorBy"),
+		Samples: parseSampleNames(c.QueryArray("sample")),
+	}
+
+	browser.serveTracks(c, func(ctx context.Context, genome *Genome, id string, credentials Credentials, permissions *Permissions) ([]Track, error) {
+		return browser.DataHandler.GetVcfTrack(ctx, genome, id, credentials, permissions, options)
+	})
+}
+
+//serveTracks Responds with the tracks of the object group in the request uri
+func (browser *BrowserEndpoints) serveTracks(c *gin.Context, loadTracks trackLoader) {
+	var id GenomeTrackID
 	err := c.BindUri(&id)
 	if err != nil {
-		log.Println(err.Error())
-		c.AbortWithError(400, err)
+		abortWithDataError(c, &InvalidRequestError{Err: err})
 		return
 	}
 
-	token := browser.AutHandler.GetAccessTokenFromGinContext(c)
+	genome, ok := browser.DataHandler.GetGenome(id.Genome)
+	if !ok {
+		abortWithDataError(c, &NotFoundError{Resource: "genome", ID: id.Genome})
+		return
+	}
 
-	token = os.Getenv("APIToken")
+	credentials, err := browser.AutHandler.CredentialsFromGinContext(c)
+	if err != nil {
+		abortWithDataError(c, err)
+		return
+	}
 
-	tracks, err := browser.DataHandler.GetBamTrack(id.ID, token)
+	tracks, err := loadTracks(c.Request.Context(), genome, id.ID, credentials, browser.Access.PermissionsFor(UserFromGinContext(c)))
 	if err != nil {
-		log.Println(err.Error())
-		c.AbortWithError(400, err)
+		abortWithDataError(c, err)
 		return
 	}
 
 	c.JSON(200, tracks)
 }
 
-//IGVBrowser Starts the igv viewer
+//IGVBrowser Starts the igv viewer for the genome selected with the genome query parameter, defaults to the first genome
 func (browser *BrowserEndpoints) IGVBrowser(c *gin.Context) {
-	token := browser.AutHandler.GetAccessTokenFromGinContext(c)
+	genome := browser.DataHandler.Genomes[0]
+	if genomeID := c.Query("genome"); genomeID != "" {
+		selectedGenome, ok := browser.DataHandler.GetGenome(genomeID)
+		if !ok {
+			renderDataError(c, &NotFoundError{Resource: "genome", ID: genomeID})
+			return
+		}
+		genome = selectedGenome
+	}
 
-	token = os.Getenv("APIToken")
+	browser.renderBrowser(c, genome, "")
+}
 
-	bigWigsList, err := browser.DataHandler.GetBigWigsList(token)
+//renderBrowser Renders the igv viewer with the track lists of the genome, sessionID is the id of a saved view that is restored or empty
+func (browser *BrowserEndpoints) renderBrowser(c *gin.Context, genome *Genome, sessionID string) {
+	credentials, err := browser.AutHandler.CredentialsFromGinContext(c)
 	if err != nil {
-		log.Println(err.Error())
-		c.AbortWithError(400, err)
+		renderDataError(c, err)
 		return
 	}
 
-	bamList, err := browser.DataHandler.GetBamList(token)
+	permissions := browser.Access.PermissionsFor(UserFromGinContext(c))
+
+	var bigWigsList, bamList, cramList, vcfList, featuresList map[string][]FileGroup
+	listCall := func(trackType TrackType, list *map[string][]FileGroup, getList func(ctx context.Context, genome *Genome, credentials Credentials, permissions *Permissions) (map[string][]FileGroup, error)) datasetCall {
+		return datasetCall{
+			TrackType: trackType,
+			Call: func(ctx context.Context) error {
+				var err error
+				*list, err = getList(ctx, genome, credentials, permissions)
+				return err
+			},
+		}
+	}
+
+	err = browser.DataHandler.runDatasetCalls(c.Request.Context(), genome,
+		listCall(BigWigs, &bigWigsList, browser.DataHandler.GetBigWigsList),
+		listCall(BAM, &bamList, browser.DataHandler.GetBamList),
+		listCall(CRAM, &cramList, browser.DataHandler.GetCramList),
+		listCall(VCF, &vcfList, browser.DataHandler.GetVcfList),
+		listCall(Features, &featuresList, browser.DataHandler.GetFeaturesList),
+	)
 	if err != nil {
-		log.Println(err.Error())
-		c.AbortWithError(400, err)
+		renderDataError(c, err)
 		return
 	}
 
-	c.HTML(200, "browser.html", gin.H{"BigWigsList": bigWigsList, "BamList": bamList})
-}
-
-func (browser *BrowserEndpoints) outgoingContext() context.Context {
-	return browser.DataHandler.GRPCEndpoints.OutGoingContextFromToken(browser.Token, client.UserAPIToken)
+	c.HTML(200, "browser.html", gin.H{
+		"BigWigsList":  bigWigsList,
+		"BamList":      bamList,
+		"CramList":     cramList,
+		"VcfList":      vcfList,
+		"FeaturesList": featuresList,
+		"User":         UserFromGinContext(c),
+		"PublicMode":   browser.AutHandler.PublicMode,
+		"Genome":       genome,
+		"Genomes":      browser.DataHandler.Genomes,
+		"SessionID":    sessionID,
+	})
 }
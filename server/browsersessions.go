@@ -0,0 +1,531 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+const (
+	//maxBrowserSessionTracks Limits the size of a saved view
+	maxBrowserSessionTracks = 200
+	maxBrowserSessionName   = 200
+	maxBrowserSessionLocus  = 1000
+)
+
+var errBrowserSessionNotFound = errors.New("browser session not found")
+
+//browserSessionIDPattern Ids are created with randomString and are used as filenames
+var browserSessionIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+//trackKinds The track endpoints of a genome that can be restored from a saved view
+var trackKinds = map[string]TrackType{
+	"bigWigsTrack":  BigWigs,
+	"bamTrack":      BAM,
+	"cramTrack":     CRAM,
+	"vcfTrack":      VCF,
+	"featuresTrack": Features,
+}
+
+//BrowserSession A saved view of the igv browser that can be shared by its url
+//Only the ids of the object groups are stored, the tracks are loaded with the permissions of the viewer
+type BrowserSession struct {
+	ID      string         `json:"id"`
+	Name    string         `json:"name"`
+	Owner   string         `json:"owner"`
+	Genome  string         `json:"genome"`
+	Locus   string         `json:"locus"`
+	Tracks  []SessionTrack `json:"tracks"`
+	Created time.Time      `json:"created"`
+	Updated time.Time      `json:"updated"`
+}
+
+//SessionTrack A loaded track of a saved view
+type SessionTrack struct {
+	//Kind The track endpoint, e.g. bamTrack
+	Kind string `json:"kind"`
+	//ID The object group id
+	ID       string        `json:"id"`
+	Settings TrackSettings `json:"settings"`
+}
+
+//TrackSettings Display settings that were changed in the browser, unset settings keep the defaults of the track
+type TrackSettings struct {
+	Name        string   `json:"name,omitempty"`
+	Color       string   `json:"color,omitempty"`
+	AltColor    string   `json:"altColor,omitempty"`
+	DisplayMode string   `json:"displayMode,omitempty"`
+	Height      int      `json:"height,omitempty"`
+	Min         *float64 `json:"min,omitempty"`
+	Max         *float64 `json:"max,omitempty"`
+	AutoScale   *bool    `json:"autoscale,omitempty"`
+	ColorBy     string   `json:"colorBy,omitempty"`
+	Samples     []string `json:"samples,omitempty"`
+}
+
+//BrowserSessionStore Persists the saved views
+type BrowserSessionStore interface {
+	//Get Returns the saved view with the given id or errBrowserSessionNotFound
+	Get(id string) (*BrowserSession, error)
+	//Save Creates or replaces a saved view
+	Save(session *BrowserSession) error
+	//Delete Removes a saved view, deleting an unknown view is not an error
+	Delete(id string) error
+	//List Returns all saved views of an owner
+	List(owner string) ([]*BrowserSession, error)
+}
+
+//NewBrowserSessionStoreFromConfig Creates the store configured in the BrowserSessions section
+//Views are kept in memory if no directory is configured
+func NewBrowserSessionStoreFromConfig() (BrowserSessionStore, error) {
+	dir := viper.GetString("BrowserSessions.Dir")
+	if dir == "" {
+		log.Println("BrowserSessions.Dir is not set, saved views are lost on restart")
+		return NewMemoryBrowserSessionStore(), nil
+	}
+
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	return &FileBrowserSessionStore{Dir: dir}, nil
+}
+
+//MemoryBrowserSessionStore Keeps the saved views in memory
+type MemoryBrowserSessionStore struct {
+	mutex    sync.RWMutex
+	sessions map[string]BrowserSession
+}
+
+//NewMemoryBrowserSessionStore Creates an empty in memory store
+func NewMemoryBrowserSessionStore() *MemoryBrowserSessionStore {
+	return &MemoryBrowserSessionStore{
+		sessions: make(map[string]BrowserSession),
+	}
+}
+
+//Get Returns a copy of the saved view
+func (store *MemoryBrowserSessionStore) Get(id string) (*BrowserSession, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	session, ok := store.sessions[id]
+	if !ok {
+		return nil, errBrowserSessionNotFound
+	}
+
+	return &session, nil
+}
+
+//Save Stores a copy of the saved view
+func (store *MemoryBrowserSessionStore) Save(session *BrowserSession) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.sessions[session.ID] = *session
+	return nil
+}
+
+//Delete Removes a saved view
+func (store *MemoryBrowserSessionStore) Delete(id string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	delete(store.sessions, id)
+	return nil
+}
+
+//List Returns the saved views of an owner
+func (store *MemoryBrowserSessionStore) List(owner string) ([]*BrowserSession, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	var sessions []*BrowserSession
+	for _, session := range store.sessions {
+		if session.Owner == owner {
+			sessionCopy := session
+			sessions = append(sessions, &sessionCopy)
+		}
+	}
+
+	return sessions, nil
+}
+
+//FileBrowserSessionStore Stores every saved view as json file in Dir
+type FileBrowserSessionStore struct {
+	Dir   string
+	mutex sync.RWMutex
+}
+
+//Get Reads a saved view
+func (store *FileBrowserSessionStore) Get(id string) (*BrowserSession, error) {
+	if !browserSessionIDPattern.MatchString(id) {
+		return nil, errBrowserSessionNotFound
+	}
+
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	return store.read(filepath.Join(store.Dir, id+".json"))
+}
+
+//Save Writes a saved view atomically
+func (store *FileBrowserSessionStore) Save(session *BrowserSession) error {
+	if !browserSessionIDPattern.MatchString(session.ID) {
+		return fmt.Errorf("invalid browser session id: %v", session.ID)
+	}
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		log.Println(err.Error())
+		return err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	tmpFile, err := ioutil.TempFile(store.Dir, ".browsersession-*")
+	if err != nil {
+		log.Println(err.Error())
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.Write(data)
+	if err != nil {
+		tmpFile.Close()
+		log.Println(err.Error())
+		return err
+	}
+
+	err = tmpFile.Close()
+	if err != nil {
+		log.Println(err.Error())
+		return err
+	}
+
+	return os.Rename(tmpFile.Name(), filepath.Join(store.Dir, session.ID+".json"))
+}
+
+//Delete Removes the file of a saved view
+func (store *FileBrowserSessionStore) Delete(id string) error {
+	if !browserSessionIDPattern.MatchString(id) {
+		return nil
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	err := os.Remove(filepath.Join(store.Dir, id+".json"))
+	if err != nil && !os.IsNotExist(err) {
+		log.Println(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+//List Reads all saved views and returns those of the owner
+func (store *FileBrowserSessionStore) List(owner string) ([]*BrowserSession, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	files, err := filepath.Glob(filepath.Join(store.Dir, "*.json"))
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	var sessions []*BrowserSession
+	for _, file := range files {
+		session, err := store.read(file)
+		if err != nil {
+			log.Println(err.Error())
+			continue
+		}
+
+		if session.Owner == owner {
+			sessions = append(sessions, session)
+		}
+	}
+
+	return sessions, nil
+}
+
+func (store *FileBrowserSessionStore) read(file string) (*BrowserSession, error) {
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, errBrowserSessionNotFound
+	}
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	var session BrowserSession
+	err = json.Unmarshal(data, &session)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+//BrowserSessionEndpoints CRUD endpoints for the saved views under /sessions
+//Everybody with the link can read a view, only its owner can change or delete it
+type BrowserSessionEndpoints struct {
+	Store       BrowserSessionStore
+	DataHandler DataHandler
+	Browser     *BrowserEndpoints
+	//ExternalURL Base url of the dashboard used for the urls in igv.js exports, taken from the request if empty
+	ExternalURL string
+}
+
+//List Returns the saved views of the logged in user, the newest first
+func (endpoints *BrowserSessionEndpoints) List(c *gin.Context) {
+	user := UserFromGinContext(c)
+	if user == nil {
+		abortWithDataError(c, errNotLoggedIn)
+		return
+	}
+
+	sessions, err := endpoints.Store.List(user.Subject)
+	if err != nil {
+		abortWithDataError(c, err)
+		return
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Updated.After(sessions[j].Updated)
+	})
+
+	if sessions == nil {
+		sessions = make([]*BrowserSession, 0)
+	}
+
+	c.JSON(200, sessions)
+}
+
+//Get Returns a saved view
+func (endpoints *BrowserSessionEndpoints) Get(c *gin.Context) {
+	session, ok := endpoints.load(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(200, session)
+}
+
+//Create Saves a new view owned by the logged in user
+func (endpoints *BrowserSessionEndpoints) Create(c *gin.Context) {
+	user := UserFromGinContext(c)
+	if user == nil {
+		abortWithDataError(c, errNotLoggedIn)
+		return
+	}
+
+	session, ok := endpoints.bind(c)
+	if !ok {
+		return
+	}
+
+	err := endpoints.saveNew(session, user)
+	if err != nil {
+		abortWithDataError(c, err)
+		return
+	}
+
+	c.JSON(201, session)
+}
+
+//saveNew Stores a new view with a random id owned by the user
+func (endpoints *BrowserSessionEndpoints) saveNew(session *BrowserSession, user *UserInfo) error {
+	id, err := randomString(16)
+	if err != nil {
+		log.Println(err.Error())
+		return err
+	}
+
+	now := time.Now()
+	session.ID = id
+	session.Owner = user.Subject
+	session.Created = now
+	session.Updated = now
+
+	err = endpoints.Store.Save(session)
+	if err != nil {
+		log.Println(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+//Update Replaces the name, locus and tracks of a view of the logged in user
+func (endpoints *BrowserSessionEndpoints) Update(c *gin.Context) {
+	existing, ok := endpoints.loadOwned(c)
+	if !ok {
+		return
+	}
+
+	session, ok := endpoints.bind(c)
+	if !ok {
+		return
+	}
+
+	session.ID = existing.ID
+	session.Owner = existing.Owner
+	session.Created = existing.Created
+	session.Updated = time.Now()
+
+	err := endpoints.Store.Save(session)
+	if err != nil {
+		abortWithDataError(c, err)
+		return
+	}
+
+	c.JSON(200, session)
+}
+
+//Delete Removes a view of the logged in user
+func (endpoints *BrowserSessionEndpoints) Delete(c *gin.Context) {
+	session, ok := endpoints.loadOwned(c)
+	if !ok {
+		return
+	}
+
+	err := endpoints.Store.Delete(session.ID)
+	if err != nil {
+		abortWithDataError(c, err)
+		return
+	}
+
+	c.Status(204)
+}
+
+//load Loads the view with the id in the request uri, aborts the request with a JSON error if it can not be loaded
+func (endpoints *BrowserSessionEndpoints) load(c *gin.Context) (*BrowserSession, bool) {
+	session, err := endpoints.find(c)
+	if err != nil {
+		abortWithDataError(c, err)
+		return nil, false
+	}
+
+	return session, true
+}
+
+//find Returns the view with the id in the request uri
+func (endpoints *BrowserSessionEndpoints) find(c *gin.Context) (*BrowserSession, error) {
+	var id ID
+	err := c.BindUri(&id)
+	if err != nil {
+		return nil, &InvalidRequestError{Err: err}
+	}
+
+	session, err := endpoints.Store.Get(id.ID)
+	if err == errBrowserSessionNotFound {
+		return nil, &NotFoundError{Resource: "saved view", ID: id.ID}
+	}
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	return session, nil
+}
+
+//loadOwned Loads a view that belongs to the logged in user
+func (endpoints *BrowserSessionEndpoints) loadOwned(c *gin.Context) (*BrowserSession, bool) {
+	user := UserFromGinContext(c)
+	if user == nil {
+		abortWithDataError(c, errNotLoggedIn)
+		return nil, false
+	}
+
+	session, ok := endpoints.load(c)
+	if !ok {
+		return nil, false
+	}
+
+	if session.Owner != user.Subject {
+		abortWithErrorResponse(c, 403, "forbidden", errors.New("only the owner may change a saved view"))
+		return nil, false
+	}
+
+	return session, true
+}
+
+//bind Reads and validates a view from the request body
+func (endpoints *BrowserSessionEndpoints) bind(c *gin.Context) (*BrowserSession, bool) {
+	var session BrowserSession
+	err := c.ShouldBindJSON(&session)
+	if err != nil {
+		abortWithDataError(c, &InvalidRequestError{Err: err})
+		return nil, false
+	}
+
+	err = endpoints.validate(&session)
+	if err != nil {
+		abortWithDataError(c, &InvalidRequestError{Err: err})
+		return nil, false
+	}
+
+	return &session, true
+}
+
+func (endpoints *BrowserSessionEndpoints) validate(session *BrowserSession) error {
+	if _, ok := endpoints.DataHandler.GetGenome(session.Genome); !ok {
+		return fmt.Errorf("unknown genome: %v", session.Genome)
+	}
+
+	if len(session.Name) > maxBrowserSessionName || len(session.Locus) > maxBrowserSessionLocus {
+		return fmt.Errorf("name or locus of the browser session is too long")
+	}
+
+	if len(session.Tracks) > maxBrowserSessionTracks {
+		return fmt.Errorf("a browser session can contain at most %v tracks", maxBrowserSessionTracks)
+	}
+
+	for _, track := range session.Tracks {
+		if _, ok := trackKinds[track.Kind]; !ok {
+			return fmt.Errorf("unknown track kind: %v", track.Kind)
+		}
+		if track.ID == "" {
+			return fmt.Errorf("track without id")
+		}
+	}
+
+	return nil
+}
+
+//Restore Starts the igv viewer for the genome of a saved view, the view is restored by initIGV.js
+//Errors are shown as error page
+func (endpoints *BrowserSessionEndpoints) Restore(c *gin.Context) {
+	session, err := endpoints.find(c)
+	if err != nil {
+		renderDataError(c, err)
+		return
+	}
+
+	genome, ok := endpoints.DataHandler.GetGenome(session.Genome)
+	if !ok {
+		renderDataError(c, &NotFoundError{Resource: "genome", ID: session.Genome})
+		return
+	}
+
+	endpoints.Browser.renderBrowser(c, genome, session.ID)
+}
@@ -0,0 +1,362 @@
+package server
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"golang.org/x/sync/singleflight"
+)
+
+//CachedSource TrackSource that caches dataset versions, object group lists and download links of another source
+//Entries are kept per token, so users only get cached responses that were requested with their own credentials.
+//Concurrent misses of the same entry are combined into one request to the source.
+type CachedSource struct {
+	Source TrackSource
+	//TTL Lifetime of object group lists and download links, download links are removed before they expire
+	TTL time.Duration
+	//VersionTTL Lifetime of the current dataset versions, a new version invalidates all entries of the dataset
+	VersionTTL time.Duration
+	//MaxEntries The least recently used entries are removed if the cache contains more entries
+	MaxEntries int
+	//LinkMargin Download links are removed from the cache if they expire within the margin
+	LinkMargin time.Duration
+	//LoadTimeout Deadline of a shared request to the source, which is not bound to the request that started it
+	LoadTimeout time.Duration
+
+	mutex   sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	//versions Last seen version of every dataset
+	versions map[string]string
+	requests singleflight.Group
+}
+
+//cacheEntry A cached response and the dataset it belongs to
+type cacheEntry struct {
+	key       string
+	datasetID string
+	value     interface{}
+	expires   time.Time
+}
+
+//NewCachedSourceFromConfig Wraps the source in a cache configured in the Cache section
+//Returns the source itself if the cache is disabled
+func NewCachedSourceFromConfig(source TrackSource) TrackSource {
+	viper.SetDefault("Cache.Enabled", true)
+	viper.SetDefault("Cache.TTL", "5m")
+	viper.SetDefault("Cache.VersionTTL", "30s")
+	viper.SetDefault("Cache.MaxEntries", 1000)
+	viper.SetDefault("Links.RefreshMargin", "1m")
+
+	if !viper.GetBool("Cache.Enabled") {
+		return source
+	}
+
+	return &CachedSource{
+		Source:      source,
+		TTL:         viper.GetDuration("Cache.TTL"),
+		VersionTTL:  viper.GetDuration("Cache.VersionTTL"),
+		MaxEntries:  viper.GetInt("Cache.MaxEntries"),
+		LinkMargin:  viper.GetDuration("Links.RefreshMargin"),
+		LoadTimeout: viper.GetDuration("Backend.CallTimeout"),
+		entries:     make(map[string]*list.Element),
+		lru:         list.New(),
+		versions:    make(map[string]string),
+	}
+}
+
+//GetCurrentDatasetVersion Returns the cached current version of a dataset
+func (cache *CachedSource) GetCurrentDatasetVersion(ctx context.Context, datasetID string, credentials Credentials) (*DatasetVersion, error) {
+	value, err := cache.get(ctx, "version/"+tokenScope(credentials)+"/"+datasetID, func(ctx context.Context) (*cacheEntry, error) {
+		datasetVersion, err := cache.Source.GetCurrentDatasetVersion(ctx, datasetID, credentials)
+		if err != nil {
+			return nil, err
+		}
+
+		cache.updateVersion(datasetVersion)
+
+		return &cacheEntry{
+			datasetID: datasetID,
+			value:     *datasetVersion,
+			expires:   time.Now().Add(cache.VersionTTL),
+		}, nil
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	datasetVersion := value.(DatasetVersion)
+	return &datasetVersion, nil
+}
+
+//GetDatasetObjectGroups Returns the cached object groups of a dataset version
+func (cache *CachedSource) GetDatasetObjectGroups(ctx context.Context, datasetVersion *DatasetVersion, credentials Credentials) ([]*ObjectGroup, error) {
+	value, err := cache.get(ctx, "groups/"+tokenScope(credentials)+"/"+datasetVersion.ID, func(ctx context.Context) (*cacheEntry, error) {
+		objectGroups, err := cache.Source.GetDatasetObjectGroups(ctx, datasetVersion, credentials)
+		if err != nil {
+			return nil, err
+		}
+
+		return &cacheEntry{
+			datasetID: datasetVersion.DatasetID,
+			value:     objectGroups,
+			expires:   time.Now().Add(cache.TTL),
+		}, nil
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	return copyObjectGroups(value.([]*ObjectGroup)), nil
+}
+
+//GetDatasetDownloadLinks Returns the cached object groups of a dataset version with their download links
+func (cache *CachedSource) GetDatasetDownloadLinks(ctx context.Context, datasetVersion *DatasetVersion, credentials Credentials) ([]*ObjectGroup, error) {
+	value, err := cache.get(ctx, "links/"+tokenScope(credentials)+"/"+datasetVersion.ID, func(ctx context.Context) (*cacheEntry, error) {
+		objectGroups, err := cache.Source.GetDatasetDownloadLinks(ctx, datasetVersion, credentials)
+		if err != nil {
+			return nil, err
+		}
+
+		return &cacheEntry{
+			datasetID: datasetVersion.DatasetID,
+			value:     objectGroups,
+			expires:   cache.linksExpire(objectGroups),
+		}, nil
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	return copyObjectGroups(value.([]*ObjectGroup)), nil
+}
+
+//GetObjectGroup Returns a cached object group with its download links
+func (cache *CachedSource) GetObjectGroup(ctx context.Context, groupID string, credentials Credentials) (*ObjectGroup, error) {
+	value, err := cache.get(ctx, "group/"+tokenScope(credentials)+"/"+groupID, func(ctx context.Context) (*cacheEntry, error) {
+		objectGroup, err := cache.Source.GetObjectGroup(ctx, groupID, credentials)
+		if err != nil {
+			return nil, err
+		}
+
+		return &cacheEntry{
+			datasetID: objectGroup.DatasetID,
+			value:     []*ObjectGroup{objectGroup},
+			expires:   cache.linksExpire([]*ObjectGroup{objectGroup}),
+		}, nil
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	return copyObjectGroups(value.([]*ObjectGroup))[0], nil
+}
+
+//Invalidate Removes all entries of a dataset, all entries are removed if the dataset id is empty
+//Returns the number of removed entries
+func (cache *CachedSource) Invalidate(datasetID string) int {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if datasetID == "" {
+		removed := cache.lru.Len()
+		cache.entries = make(map[string]*list.Element)
+		cache.lru.Init()
+		cache.versions = make(map[string]string)
+		return removed
+	}
+
+	delete(cache.versions, datasetID)
+	return cache.removeDataset(datasetID)
+}
+
+//get Returns the value of an entry, a missing or expired entry is loaded once for all concurrent requests
+//The load is not bound to the context of the request that started it, so a cancelled request does not fail the others.
+//Every request still stops waiting when its own context is done.
+func (cache *CachedSource) get(ctx context.Context, key string, load func(ctx context.Context) (*cacheEntry, error)) (interface{}, error) {
+	if value, ok := cache.lookup(key); ok {
+		return value, nil
+	}
+
+	result := cache.requests.DoChan(key, func() (interface{}, error) {
+		loadCtx := context.Background()
+		if cache.LoadTimeout > 0 {
+			var cancel context.CancelFunc
+			loadCtx, cancel = context.WithTimeout(loadCtx, cache.LoadTimeout)
+			defer cancel()
+		}
+
+		entry, err := load(loadCtx)
+		if err != nil {
+			return nil, err
+		}
+
+		entry.key = key
+		cache.store(entry)
+		return entry.value, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case loaded := <-result:
+		return loaded.Val, loaded.Err
+	}
+}
+
+func (cache *CachedSource) lookup(key string) (interface{}, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	element, ok := cache.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := element.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		cache.lru.Remove(element)
+		delete(cache.entries, key)
+		return nil, false
+	}
+
+	cache.lru.MoveToFront(element)
+	return entry.value, true
+}
+
+func (cache *CachedSource) store(entry *cacheEntry) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if element, ok := cache.entries[entry.key]; ok {
+		cache.lru.Remove(element)
+	}
+	cache.entries[entry.key] = cache.lru.PushFront(entry)
+
+	for cache.MaxEntries > 0 && cache.lru.Len() > cache.MaxEntries {
+		oldest := cache.lru.Back()
+		cache.lru.Remove(oldest)
+		delete(cache.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+//updateVersion Invalidates the entries of a dataset if the source reports a new version
+func (cache *CachedSource) updateVersion(datasetVersion *DatasetVersion) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	lastVersion, ok := cache.versions[datasetVersion.DatasetID]
+	cache.versions[datasetVersion.DatasetID] = datasetVersion.ID
+	if !ok || lastVersion == datasetVersion.ID {
+		return
+	}
+
+	removed := cache.removeDataset(datasetVersion.DatasetID)
+	log.Printf("Dataset %v has a new version %v, removed %v cache entries", datasetVersion.DatasetID, datasetVersion.ID, removed)
+}
+
+//removeDataset Removes the entries of a dataset, the caller has to hold the mutex
+func (cache *CachedSource) removeDataset(datasetID string) int {
+	removed := 0
+	for key, element := range cache.entries {
+		if element.Value.(*cacheEntry).datasetID == datasetID {
+			cache.lru.Remove(element)
+			delete(cache.entries, key)
+			removed++
+		}
+	}
+
+	return removed
+}
+
+//linksExpire Returns the time the entry of the download links expires, before the first of the links expires
+func (cache *CachedSource) linksExpire(objectGroups []*ObjectGroup) time.Time {
+	expires := time.Now().Add(cache.TTL)
+	for _, objectGroup := range objectGroups {
+		for _, object := range objectGroup.Objects {
+			if linkExpires, ok := linkExpiry(object.URL); ok && linkExpires.Add(-cache.LinkMargin).Before(expires) {
+				expires = linkExpires.Add(-cache.LinkMargin)
+			}
+		}
+	}
+
+	return expires
+}
+
+//tokenScope Identifies the credentials of a request without keeping the token
+func tokenScope(credentials Credentials) string {
+	tokenHash := sha256.Sum256([]byte(credentials.Token))
+	return hex.EncodeToString(tokenHash[:])
+}
+
+//copyObjectGroups Copies cached object groups, the data handler changes the urls and attributes of the groups it gets
+func copyObjectGroups(objectGroups []*ObjectGroup) []*ObjectGroup {
+	copies := make([]*ObjectGroup, 0, len(objectGroups))
+	for _, objectGroup := range objectGroups {
+		groupCopy := *objectGroup
+
+		groupCopy.Objects = make([]*Object, 0, len(objectGroup.Objects))
+		for _, object := range objectGroup.Objects {
+			objectCopy := *object
+			groupCopy.Objects = append(groupCopy.Objects, &objectCopy)
+		}
+
+		if objectGroup.Attributes != nil {
+			groupCopy.Attributes = make(map[string]string, len(objectGroup.Attributes))
+			for key, value := range objectGroup.Attributes {
+				groupCopy.Attributes[key] = value
+			}
+		}
+
+		copies = append(copies, &groupCopy)
+	}
+
+	return copies
+}
+
+//CacheEndpoints Administration of the cache
+type CacheEndpoints struct {
+	Cache  *CachedSource
+	Access *AccessPolicy
+	//Replica Name of the replica that serves the request, the cache is not shared between replicas
+	Replica string
+}
+
+//Invalidate Removes the cache entries of the dataset in the dataset query parameter or all entries
+//Only the cache of the replica that receives the request is cleared, the other replicas keep their entries for at most the TTL
+func (endpoints *CacheEndpoints) Invalidate(c *gin.Context) {
+	user := UserFromGinContext(c)
+	if user == nil {
+		abortWithDataError(c, errNotLoggedIn)
+		return
+	}
+	if !endpoints.Access.IsAdmin(user) {
+		abortWithErrorResponse(c, 403, "forbidden", errors.New("only admins may invalidate the cache"))
+		return
+	}
+
+	datasetID := c.Query("dataset")
+	removed := endpoints.Cache.Invalidate(datasetID)
+	log.Printf("Cache of replica %v invalidated by %v for dataset %q, removed %v entries", endpoints.Replica, user.Subject, datasetID, removed)
+
+	c.JSON(200, gin.H{
+		"removed": removed,
+		"scope":   "replica",
+		"replica": endpoints.Replica,
+		//Entries of other replicas expire after the TTL, new dataset versions are noticed after the VersionTTL
+		"ttl":        endpoints.Cache.TTL.String(),
+		"versionTTL": endpoints.Cache.VersionTTL.String(),
+	})
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"container/list"
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//blockingSource Returns a dataset version after release is closed and fails if its context is cancelled before
+type blockingSource struct {
+	LocalSource
+	release chan struct{}
+	calls   int32
+}
+
+func (source *blockingSource) GetCurrentDatasetVersion(ctx context.Context, datasetID string, credentials Credentials) (*DatasetVersion, error) {
+	atomic.AddInt32(&source.calls, 1)
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-source.release:
+		return &DatasetVersion{ID: "v1", DatasetID: datasetID}, nil
+	}
+}
+
+func TestCachedSourceSharedLoadOutlivesCancelledRequest(t *testing.T) {
+	source := &blockingSource{release: make(chan struct{})}
+	cache := &CachedSource{
+		Source:      source,
+		TTL:         time.Minute,
+		VersionTTL:  time.Minute,
+		LoadTimeout: time.Minute,
+		entries:     make(map[string]*list.Element),
+		lru:         list.New(),
+		versions:    make(map[string]string),
+	}
+
+	firstCtx, cancelFirst := context.WithCancel(context.Background())
+	firstErr := make(chan error)
+	go func() {
+		_, err := cache.GetCurrentDatasetVersion(firstCtx, "dataset", Credentials{})
+		firstErr <- err
+	}()
+
+	//Wait until the first request started the load, the second one joins it
+	for atomic.LoadInt32(&source.calls) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	secondResult := make(chan *DatasetVersion)
+	go func() {
+		datasetVersion, err := cache.GetCurrentDatasetVersion(context.Background(), "dataset", Credentials{})
+		if err != nil {
+			t.Error(err)
+		}
+		secondResult <- datasetVersion
+	}()
+
+	cancelFirst()
+	if err := <-firstErr; err != context.Canceled {
+		t.Errorf("got error %v for the cancelled request, want %v", err, context.Canceled)
+	}
+
+	close(source.release)
+	if datasetVersion := <-secondResult; datasetVersion == nil || datasetVersion.ID != "v1" {
+		t.Fatalf("got version %+v for the second request", datasetVersion)
+	}
+
+	//The result of the shared load is cached
+	datasetVersion, err := cache.GetCurrentDatasetVersion(context.Background(), "dataset", Credentials{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if datasetVersion.ID != "v1" || atomic.LoadInt32(&source.calls) != 1 {
+		t.Errorf("got version %+v after %v calls to the source, want one call", datasetVersion, source.calls)
+	}
+}
@@ -0,0 +1,241 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+//BackendUnavailableError Returned if all attempts of a call failed or without a call while the circuit breaker of the BioDataDB is open
+type BackendUnavailableError struct {
+	//RetryAfter Remaining time until the breaker lets calls through, zero if the breaker is closed
+	RetryAfter time.Duration
+	//Err Error of the last attempt
+	Err error
+}
+
+func (err *BackendUnavailableError) Error() string {
+	if err.Err != nil {
+		return fmt.Sprintf("BioDataDB is unavailable: %v", err.Err.Error())
+	}
+	return fmt.Sprintf("BioDataDB is unavailable, retry after %v", err.RetryAfter)
+}
+
+//Unwrap Returns the error of the last attempt
+func (err *BackendUnavailableError) Unwrap() error {
+	return err.Err
+}
+
+//CallPolicy Deadlines, retries and circuit breaking of the calls to the BioDataDB
+type CallPolicy struct {
+	//Timeout Deadline of a call attempt, Timeouts overrides it per gRPC method
+	Timeout  time.Duration
+	Timeouts map[string]time.Duration
+	//MaxAttempts Number of attempts of a call that fails with UNAVAILABLE or DEADLINE_EXCEEDED
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Breaker        *CircuitBreaker
+}
+
+//NewCallPolicyFromConfig Reads the call policy from the Endpoints.DatasetHandler config section
+func NewCallPolicyFromConfig() (*CallPolicy, error) {
+	viper.SetDefault("Endpoints.DatasetHandler.Timeout", "10s")
+	viper.SetDefault("Endpoints.DatasetHandler.Retry.MaxAttempts", 3)
+	viper.SetDefault("Endpoints.DatasetHandler.Retry.InitialBackoff", "100ms")
+	viper.SetDefault("Endpoints.DatasetHandler.Retry.MaxBackoff", "2s")
+	viper.SetDefault("Endpoints.DatasetHandler.CircuitBreaker.FailureThreshold", 5)
+	viper.SetDefault("Endpoints.DatasetHandler.CircuitBreaker.OpenDuration", "30s")
+
+	//Viper lowercases the keys, the methods are looked up in lower case
+	timeouts := make(map[string]time.Duration)
+	for method, value := range viper.GetStringMapString("Endpoints.DatasetHandler.Timeouts") {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			err := fmt.Errorf("invalid timeout of method %v: %v", method, err.Error())
+			log.Println(err.Error())
+			return nil, err
+		}
+		timeouts[strings.ToLower(method)] = timeout
+	}
+
+	return &CallPolicy{
+		Timeout:        viper.GetDuration("Endpoints.DatasetHandler.Timeout"),
+		Timeouts:       timeouts,
+		MaxAttempts:    viper.GetInt("Endpoints.DatasetHandler.Retry.MaxAttempts"),
+		InitialBackoff: viper.GetDuration("Endpoints.DatasetHandler.Retry.InitialBackoff"),
+		MaxBackoff:     viper.GetDuration("Endpoints.DatasetHandler.Retry.MaxBackoff"),
+		Breaker: &CircuitBreaker{
+			FailureThreshold: viper.GetInt("Endpoints.DatasetHandler.CircuitBreaker.FailureThreshold"),
+			OpenDuration:     viper.GetDuration("Endpoints.DatasetHandler.CircuitBreaker.OpenDuration"),
+		},
+	}, nil
+}
+
+//call Runs an idempotent gRPC call with the deadline of the method
+//Attempts that fail with UNAVAILABLE or DEADLINE_EXCEEDED are retried with exponential backoff as long as the request is not cancelled
+func (policy *CallPolicy) call(ctx context.Context, method string, call func(ctx context.Context) error) error {
+	var err error
+	for attempt := 0; attempt < policy.MaxAttempts || attempt == 0; attempt++ {
+		if attempt > 0 {
+			err := policy.wait(ctx, attempt)
+			if err != nil {
+				return err
+			}
+		}
+
+		var probe bool
+		probe, err = policy.Breaker.allow()
+		if err != nil {
+			return err
+		}
+
+		err = policy.attempt(ctx, method, call)
+		//A cancelled request tells nothing about the backend
+		if ctx.Err() != nil {
+			policy.Breaker.release(probe)
+			return err
+		}
+
+		transient := isTransient(err)
+		policy.Breaker.record(probe, !transient)
+		if !transient {
+			return err
+		}
+
+		log.Printf("Attempt %v of %v failed: %v", attempt+1, method, err.Error())
+	}
+
+	return &BackendUnavailableError{Err: err}
+}
+
+func (policy *CallPolicy) attempt(ctx context.Context, method string, call func(ctx context.Context) error) error {
+	timeout, ok := policy.Timeouts[strings.ToLower(method)]
+	if !ok {
+		timeout = policy.Timeout
+	}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	return call(ctx)
+}
+
+//wait Sleeps for the backoff of an attempt with jitter, returns early if the request is cancelled
+func (policy *CallPolicy) wait(ctx context.Context, attempt int) error {
+	backoff := policy.InitialBackoff << uint(attempt-1)
+	if backoff > policy.MaxBackoff || backoff <= 0 {
+		backoff = policy.MaxBackoff
+	}
+	backoff = backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+//isTransient Returns true for errors after which a call can be retried
+func isTransient(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	}
+
+	return false
+}
+
+//CircuitBreaker Stops the calls to the BioDataDB after FailureThreshold consecutive transient failures
+//After OpenDuration a single call is let through, the breaker is closed again if it succeeds
+type CircuitBreaker struct {
+	FailureThreshold int
+	OpenDuration     time.Duration
+
+	mutex     sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+//allow Returns a BackendUnavailableError while the breaker is open or another call probes the backend
+//probe is true if the call is the single call let through after OpenDuration, it has to be passed to record or release
+func (breaker *CircuitBreaker) allow() (probe bool, err error) {
+	if breaker == nil || breaker.FailureThreshold <= 0 {
+		return false, nil
+	}
+
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	if breaker.failures < breaker.FailureThreshold {
+		return false, nil
+	}
+
+	now := time.Now()
+	if now.Before(breaker.openUntil) {
+		return false, &BackendUnavailableError{RetryAfter: breaker.openUntil.Sub(now)}
+	}
+
+	if breaker.probing {
+		return false, &BackendUnavailableError{RetryAfter: breaker.OpenDuration}
+	}
+
+	breaker.probing = true
+	return true, nil
+}
+
+//record Counts consecutive transient failures, successful calls and other errors show that the backend is reachable
+//Calls that started before the breaker opened are counted as well, but only the probe ends the probing
+func (breaker *CircuitBreaker) record(probe bool, reachable bool) {
+	if breaker == nil || breaker.FailureThreshold <= 0 {
+		return
+	}
+
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	if probe {
+		breaker.probing = false
+	}
+	if reachable {
+		if breaker.failures >= breaker.FailureThreshold {
+			log.Println("BioDataDB is reachable again, circuit breaker closed")
+		}
+		breaker.failures = 0
+		return
+	}
+
+	breaker.failures++
+	if breaker.failures >= breaker.FailureThreshold {
+		breaker.openUntil = time.Now().Add(breaker.OpenDuration)
+		log.Printf("BioDataDB failed %v times, circuit breaker open for %v", breaker.failures, breaker.OpenDuration)
+	}
+}
+
+//release Lets another call probe the backend if the probing call was cancelled, other cancelled calls do not change the breaker
+func (breaker *CircuitBreaker) release(probe bool) {
+	if breaker == nil || !probe {
+		return
+	}
+
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	breaker.probing = false
+}
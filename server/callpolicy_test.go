@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCircuitBreakerProbe(t *testing.T) {
+	breaker := &CircuitBreaker{FailureThreshold: 1, OpenDuration: time.Millisecond}
+
+	breaker.record(false, false)
+	if _, err := breaker.allow(); err == nil {
+		t.Fatal("breaker is not open after a failure")
+	}
+	time.Sleep(2 * breaker.OpenDuration)
+
+	probe, err := breaker.allow()
+	if err != nil || !probe {
+		t.Fatalf("got probe %v and error %v after the open duration, want a probe", probe, err)
+	}
+	if _, err := breaker.allow(); err == nil {
+		t.Fatal("a second call was let through while probing")
+	}
+
+	//A cancelled call that is not the probe must not let other calls through
+	breaker.release(false)
+	if _, err := breaker.allow(); err == nil {
+		t.Fatal("a call was let through after another call than the probe was cancelled")
+	}
+	breaker.record(probe, true)
+	if probe, err := breaker.allow(); err != nil || probe {
+		t.Fatalf("got probe %v and error %v after a successful probe, want a closed breaker", probe, err)
+	}
+
+	breaker.record(false, false)
+	time.Sleep(2 * breaker.OpenDuration)
+	probe, err = breaker.allow()
+	if err != nil || !probe {
+		t.Fatalf("got probe %v and error %v, want a probe", probe, err)
+	}
+
+	//The cancelled probe lets the next call probe the backend
+	breaker.release(probe)
+	if probe, err := breaker.allow(); err != nil || !probe {
+		t.Fatalf("got probe %v and error %v after the probe was cancelled, want a new probe", probe, err)
+	}
+}
+
+func TestCallPolicyRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		errs         []error
+		wantAttempts int
+		wantCode     codes.Code
+		wantErr      bool
+		wantUnavail  bool
+	}{
+		{name: "success", errs: []error{nil}, wantAttempts: 1},
+		{
+			name:         "transient failure then success",
+			errs:         []error{status.Error(codes.Unavailable, "connection refused"), nil},
+			wantAttempts: 2,
+		},
+		{
+			name:         "retries exhausted",
+			errs:         []error{status.Error(codes.Unavailable, "connection refused"), status.Error(codes.DeadlineExceeded, "deadline"), status.Error(codes.Unavailable, "connection reset")},
+			wantAttempts: 3,
+			wantCode:     codes.Unavailable,
+			wantErr:      true,
+			wantUnavail:  true,
+		},
+		{
+			name:         "permanent failure is not retried",
+			errs:         []error{status.Error(codes.NotFound, "missing")},
+			wantAttempts: 1,
+			wantCode:     codes.NotFound,
+			wantErr:      true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy := &CallPolicy{
+				MaxAttempts:    3,
+				InitialBackoff: time.Millisecond,
+				MaxBackoff:     time.Millisecond,
+				Breaker:        &CircuitBreaker{FailureThreshold: 10, OpenDuration: time.Minute},
+			}
+
+			attempts := 0
+			err := policy.call(context.Background(), "GetCurrentVersionOfDataset", func(ctx context.Context) error {
+				err := test.errs[attempts]
+				attempts++
+				return err
+			})
+
+			if attempts != test.wantAttempts {
+				t.Errorf("got %v attempts, want %v", attempts, test.wantAttempts)
+			}
+			if !test.wantErr {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("got no error")
+			}
+
+			var unavailable *BackendUnavailableError
+			if errors.As(err, &unavailable) != test.wantUnavail {
+				t.Errorf("got error %v, want BackendUnavailableError: %v", err, test.wantUnavail)
+			}
+			//The error of the last attempt is kept
+			if code := status.Code(errors.Unwrap(err)); test.wantUnavail && code != test.wantCode {
+				t.Errorf("got code %v of the last attempt, want %v: %v", code, test.wantCode, err)
+			}
+			if code, _ := grpcCode(err); code != test.wantCode {
+				t.Errorf("got code %v, want %v", code, test.wantCode)
+			}
+			if statusCode, _ := errorStatus(err); test.wantUnavail && statusCode != 503 {
+				t.Errorf("got status %v, want 503", statusCode)
+			}
+		})
+	}
+}
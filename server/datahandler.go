@@ -1,17 +1,10 @@
 package server
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"log"
-	"strings"
-
-	"github.com/ag-computational-bio/BioDataDBModels/go/datasetapimodels"
-
-	"github.com/ag-computational-bio/BioDataDBModels/go/client"
-	"github.com/ag-computational-bio/BioDataDBModels/go/commonmodels"
-	"github.com/ag-computational-bio/BioDataDBModels/go/datasetentrymodels"
-	"github.com/ag-computational-bio/BioDataDBModels/go/loadmodels"
+	"time"
 )
 
 //TrackType Supported IGV track file format, associated track types can be found here: https://github.com/igvteam/igv.js/wiki/Tracks-2.0
@@ -20,6 +13,9 @@ type TrackType string
 const (
 	BigWigs  TrackType = "BigWigs"
 	BAM      TrackType = "BAM"
+	CRAM     TrackType = "CRAM"
+	VCF      TrackType = "VCF"
+	Features TrackType = "Features"
 	FastaRef TrackType = "FASTA"
 	GffRef   TrackType = "GFF"
 )
@@ -40,31 +36,54 @@ type Track struct {
 	Format     string      `json:"format,omitempty"`
 	IndexURL   string      `json:"indexURL,omitempty"`
 	Type       string      `json:"type,omitempty"`
-	Min        int         `json:"min,omitempty"`
-	Max        int         `json:"max,omitempty"`
+	Min        *float64    `json:"min,omitempty"`
+	Max        *float64    `json:"max,omitempty"`
+	Height     int         `json:"height,omitempty"`
 	AutoScale  bool        `json:"autoscale,omitempty"`
 	Color      string      `json:"color,omitempty"`
+	AltColor   string      `json:"altColor,omitempty"`
+	UseScore   bool        `json:"useScore,omitempty"`
 	Indexed    string      `json:"indexed,omitempty"`
 	AutoHeight bool        `json:"autoHeight,omitempty"`
 	Searchable bool        `json:"searchable,omitempty"`
 	GuideLines []GuideLine `json:"guidelines,omitempty"`
+	//Mirror Draws the values of a wig track below the axis, igv.js 2.7.4 can not flip a wig track so the values are negated by initIGV.js
+	Mirror bool `json:"mirror,omitempty"`
+	//Tracks Sub tracks of a merged track
+	Tracks []Track `json:"tracks,omitempty"`
+	//Variant track options https://github.com/igvteam/igv.js/wiki/Variant-Track
+	DisplayMode string   `json:"displayMode,omitempty"`
+	ColorBy     string   `json:"colorBy,omitempty"`
+	HomVarColor string   `json:"homvarColor,omitempty"`
+	HetVarColor string   `json:"hetvarColor,omitempty"`
+	HomRefColor string   `json:"homrefColor,omitempty"`
+	NoCallColor string   `json:"noCallColor,omitempty"`
+	Samples     []string `json:"samples,omitempty"`
+	//Attributes Sample attributes of the object group, used to sort and filter the tracks in the browser
+	Attributes map[string]string `json:"attributes,omitempty"`
 }
 
 //GuideLine https://github.com/igvteam/igv.js/wiki/Wig-Track
 type GuideLine struct {
 	Color  string `json:"color,omitempty"`
 	Dotted bool   `json:"dotted,omitempty"`
-	Y      int    `json:"y,omitempty"`
+	Y      int    `json:"y"`
 }
 
-//DataHandler Handles the data connection with the BioDataDB backend
+//DataHandler Handles the data connection with the configured track source
 type DataHandler struct {
-	GRPCEndpoints     client.GRPCEndpointsClients
-	AutHandler        AuthHandler
-	BWDatsetID        string
-	BamDatasetID      string
-	FastaRefDatasetID string
-	GFFDatasetID      string
+	Source         TrackSource
+	Genomes        []*Genome
+	GenotypeColors GenotypeColors
+	Strands        *StrandPatterns
+	//GroupBy Attribute that is used to subdivide the dropdown menus, all groups are listed under ALL if empty
+	GroupBy string
+	//SampleSheets Imported sample sheets, nil if sample sheets are disabled
+	SampleSheets *SampleSheetStore
+	//Links Replaces expiring download links with stable urls, nil if the links of the source do not expire
+	Links *LinkProxy
+	//CallTimeout Deadline of every concurrent backend call, no deadline if zero
+	CallTimeout time.Duration
 }
 
 //FileData Stores a structed set of filesgroups, can be used to subdivide the dropdown menu
@@ -75,9 +94,10 @@ type FileData struct {
 
 //FileGroup A group of files (reference a BioDataDB ObjectGroup)
 type FileGroup struct {
-	GroupID   string
-	GroupName string
-	Objects   []FileDescription
+	GroupID    string
+	GroupName  string
+	Objects    []FileDescription
+	Attributes map[string]string
 }
 
 //FileDescription A reference to an BioDataDB object
@@ -86,46 +106,87 @@ type FileDescription struct {
 	ID   string
 }
 
-func (datahandler *DataHandler) GetBamList(token string) (map[string][]FileGroup, error) {
-	datasetVersion, err := datahandler.getCurrentDatasetVersion(BAM, token)
+//GetBamList List of the bam files of a genome
+func (datahandler *DataHandler) GetBamList(ctx context.Context, genome *Genome, credentials Credentials, permissions *Permissions) (map[string][]FileGroup, error) {
+	return datahandler.getFileGroupList(ctx, genome, BAM, []FileFormat{FormatBAM}, credentials, permissions)
+}
+
+//GetCramList List of the cram files of a genome
+func (datahandler *DataHandler) GetCramList(ctx context.Context, genome *Genome, credentials Credentials, permissions *Permissions) (map[string][]FileGroup, error) {
+	return datahandler.getFileGroupList(ctx, genome, CRAM, []FileFormat{FormatCRAM}, credentials, permissions)
+}
+
+//GetBamTrack Returns a bam track with a specific id with the default config
+func (datahandler *DataHandler) GetBamTrack(ctx context.Context, genome *Genome, id string, credentials Credentials, permissions *Permissions) ([]Track, error) {
+	return datahandler.getAlignmentTracks(ctx, genome, BAM, FormatBAM, id, credentials, permissions)
+}
+
+//GetCramTrack Returns a cram track with a specific id with the default config
+//igv.js decodes cram reads with the sequence the browser loaded as reference, so the user has to be allowed to read the reference of the genome
+//Only the permission is checked, the track has no reference of its own and the FASTA is not looked up
+func (datahandler *DataHandler) GetCramTrack(ctx context.Context, genome *Genome, id string, credentials Credentials, permissions *Permissions) ([]Track, error) {
+	if !permissions.AllowsDataset(FastaRef) {
+		return nil, &ForbiddenError{TrackType: FastaRef}
+	}
+
+	return datahandler.getAlignmentTracks(ctx, genome, CRAM, FormatCRAM, id, credentials, permissions)
+}
+
+//getFileGroupList Lists the object groups of a dataset, named after their first data file with one of the formats
+func (datahandler *DataHandler) getFileGroupList(ctx context.Context, genome *Genome, trackType TrackType, formats []FileFormat, credentials Credentials, permissions *Permissions) (map[string][]FileGroup, error) {
+	//Only the reference, annotation and bigwigs datasets are required for a genome
+	if genome.datasetID(trackType) == "" || !permissions.AllowsAnyObjectGroup(trackType) {
+		return make(map[string][]FileGroup), nil
+	}
+
+	datasetVersion, err := datahandler.getCurrentDatasetVersion(ctx, genome, trackType, credentials)
 	if err != nil {
 		log.Println(err.Error())
 		return nil, err
 	}
 
-	groupList, err := datahandler.getDatasetObjectGroupList(BAM, datasetVersion, token)
+	groupList, err := datahandler.getDatasetObjectGroupList(ctx, trackType, datasetVersion, credentials)
 	if err != nil {
 		log.Println(err.Error())
 		return nil, err
 	}
 
-	bamList := make(map[string][]FileGroup)
 	var fileGroupData []FileGroup
 
-	for _, objectGroup := range groupList.DatasetObjectGroups {
+	for _, objectGroup := range groupList {
+		if !permissions.AllowsObjectGroup(trackType, objectGroup.ID) {
+			continue
+		}
 
-		if len(objectGroup.GetObjects()) < 1 {
-			log.Println(fmt.Sprintf("ObjectGroup with id: %v and name: %v has no associated objects", objectGroup.GetID(), objectGroup.GetName()))
+		if len(objectGroup.Objects) < 1 {
+			log.Println(fmt.Sprintf("ObjectGroup with id: %v and name: %v has no associated objects", objectGroup.ID, objectGroup.Name))
 			continue
 		}
 
+		groupName := objectGroup.Objects[0].Filename
+		if dataFiles := classifyObjectGroup(objectGroup, nil).DataFiles(formats...); len(dataFiles) > 0 {
+			groupName = dataFiles[0].Filename
+		}
+		if name := objectGroup.Attributes[sampleNameColumn]; name != "" {
+			groupName = name
+		}
+
 		objectGroupRepr := FileGroup{
-			GroupID:   objectGroup.GetID(),
-			GroupName: objectGroup.GetObjects()[0].GetFilename(),
+			GroupID:    objectGroup.ID,
+			GroupName:  groupName,
+			Attributes: objectGroup.Attributes,
 		}
 
 		fileGroupData = append(fileGroupData, objectGroupRepr)
 
 	}
 
-	bamList["ALL"] = fileGroupData
-
-	return bamList, nil
+	return groupFileGroups(fileGroupData, datahandler.GroupBy), nil
 }
 
-//GetBamTrack Returns a bam track with a specific id with the default config
-func (datahandler *DataHandler) GetBamTrack(id string, token string) ([]Track, error) {
-	objectGroup, err := datahandler.getObjectGroup(id, token)
+//getAlignmentTracks Returns an alignment track with its index for every alignment file of an object group
+func (datahandler *DataHandler) getAlignmentTracks(ctx context.Context, genome *Genome, trackType TrackType, format FileFormat, id string, credentials Credentials, permissions *Permissions) ([]Track, error) {
+	classifiedGroup, alignmentFiles, err := datahandler.getTrackFiles(ctx, genome, trackType, []FileFormat{format}, id, credentials, permissions)
 	if err != nil {
 		log.Println(err.Error())
 		return nil, err
@@ -133,95 +194,90 @@ func (datahandler *DataHandler) GetBamTrack(id string, token string) ([]Track, e
 
 	var tracks []Track
 
-	for _, objectGroup := range objectGroup.GetLinks() {
-		objects := objectGroup.GetObject().GetObjects()
-		if len(objects) < 2 {
-			err := errors.New("Not enough objects in object group for bam file")
-			log.Println(err)
+	for _, alignmentFile := range alignmentFiles {
+		index, err := classifiedGroup.IndexFor(alignmentFile)
+		if err != nil {
+			log.Println(err.Error())
+			return nil, err
 		}
 
 		track := Track{
 			Color:     "rgb(0, 0, 150)",
 			AutoScale: true,
 			Type:      "alignment",
-			Format:    "bam",
-		}
-
-		for i, object := range objects {
-			if strings.HasSuffix(object.Filename, ".bam") {
-				track.Name = object.GetFilename()
-				track.URL = objectGroup.Link[i]
-			} else if strings.HasSuffix(object.Filename, ".bam.bai") {
-				track.IndexURL = objectGroup.Link[i]
-			}
+			Format:    string(alignmentFile.Format),
+			Name:      alignmentFile.Filename,
+			URL:       alignmentFile.URL,
+			IndexURL:  index.URL,
 		}
 		tracks = append(tracks, track)
 	}
 
-	return tracks, nil
+	return withAttributes(tracks, classifiedGroup.Group.Attributes), nil
 
 }
 
 //GetBigWigsTrack Returns a bigwigs track with a specific id with the default config
-func (datahandler *DataHandler) GetBigWigsTrack(id string, token string) ([]Track, error) {
-	objectGroup, err := datahandler.getObjectGroup(id, token)
+func (datahandler *DataHandler) GetBigWigsTrack(ctx context.Context, genome *Genome, id string, credentials Credentials, permissions *Permissions) ([]Track, error) {
+	objectGroup, err := datahandler.getPermittedObjectGroup(ctx, genome, BigWigs, id, credentials, permissions)
 	if err != nil {
 		log.Println(err.Error())
 		return nil, err
 	}
 
-	var tracks []Track
-
-	for _, objects := range objectGroup.GetLinks() {
-		for i, object := range objects.GetObject().GetObjects() {
-			track := Track{
-				Color:     "rgb(0, 0, 150)",
-				AutoScale: true,
-				Type:      "wig",
-				Name:      object.GetFilename(),
-				URL:       objects.GetLink()[i],
-			}
-
-			tracks = append(tracks, track)
-		}
+	classifiedGroup := datahandler.classifyObjectGroup(objectGroup)
+	for _, object := range classifiedGroup.Unknown {
+		log.Println(fmt.Sprintf("Skipping file: %v with unknown format in object group with id: %v", object.Filename, objectGroup.ID))
 	}
 
+	tracks := datahandler.Strands.strandedTracks(classifiedGroup.DataFiles(FormatBigWig))
+	tracks = withAttributes(tracks, objectGroup.Attributes)
+
 	return tracks, nil
 
 }
 
-//GetBigWigsList List of bigwigs file grouped by forward and reverse files
-func (datahandler *DataHandler) GetBigWigsList(token string) (map[string][]FileGroup, error) {
-	datasetVersion, err := datahandler.getCurrentDatasetVersion(BigWigs, token)
+//GetBigWigsList List of bigwigs file groups, named after the sample name of their forward and reverse files
+func (datahandler *DataHandler) GetBigWigsList(ctx context.Context, genome *Genome, credentials Credentials, permissions *Permissions) (map[string][]FileGroup, error) {
+	if !permissions.AllowsAnyObjectGroup(BigWigs) {
+		return make(map[string][]FileGroup), nil
+	}
+
+	datasetVersion, err := datahandler.getCurrentDatasetVersion(ctx, genome, BigWigs, credentials)
 	if err != nil {
 		log.Println(err.Error())
 		return nil, err
 	}
 
-	groupList, err := datahandler.getDatasetObjectGroupList(BigWigs, datasetVersion, token)
+	groupList, err := datahandler.getDatasetObjectGroupList(ctx, BigWigs, datasetVersion, credentials)
 	if err != nil {
 		log.Println(err.Error())
 		return nil, err
 	}
 
-	bigWigsList := make(map[string][]FileGroup)
 	var fileGroupData []FileGroup
 
-	for _, objectGroup := range groupList.DatasetObjectGroups {
+	for _, objectGroup := range groupList {
+		if !permissions.AllowsObjectGroup(BigWigs, objectGroup.ID) {
+			continue
+		}
+
 		objectGroupRepr := FileGroup{
-			GroupID:   objectGroup.GetID(),
-			GroupName: objectGroup.GetName(),
-			Objects:   make([]FileDescription, 0),
+			GroupID:    objectGroup.ID,
+			GroupName:  objectGroup.Name,
+			Objects:    make([]FileDescription, 0),
+			Attributes: objectGroup.Attributes,
 		}
-		for _, object := range objectGroup.GetObjects() {
-			splitedString := strings.Split(object.GetFilename(), "_")
-			correctedSplittedString := splitedString[:len(splitedString)-1]
-			groupName := strings.Join(correctedSplittedString, "_")
+		for _, object := range objectGroup.Objects {
+			_, sampleName := datahandler.Strands.StrandOf(object.Filename)
 
-			objectGroupRepr.GroupName = groupName
+			objectGroupRepr.GroupName = sampleName
+			if name := objectGroup.Attributes[sampleNameColumn]; name != "" {
+				objectGroupRepr.GroupName = name
+			}
 			object := FileDescription{
-				ID:   object.GetID(),
-				Name: object.GetFilename(),
+				ID:   object.ID,
+				Name: object.Filename,
 			}
 
 			objectGroupRepr.Objects = append(objectGroupRepr.Objects, object)
@@ -230,93 +286,229 @@ func (datahandler *DataHandler) GetBigWigsList(token string) (map[string][]FileG
 		fileGroupData = append(fileGroupData, objectGroupRepr)
 	}
 
-	bigWigsList["ALL"] = fileGroupData
-
-	return bigWigsList, nil
+	return groupFileGroups(fileGroupData, datahandler.GroupBy), nil
 }
 
 //getCurrentDatasetVersion Returns the current DatasetVersion of the dataset for a specific type of track
-func (datahandler *DataHandler) getCurrentDatasetVersion(trackType TrackType, token string) (*datasetentrymodels.DatasetVersionEntry, error) {
-	var id string
-	switch trackType {
-	case BigWigs:
-		id = datahandler.BWDatsetID
-	case BAM:
-		id = datahandler.BamDatasetID
-	case FastaRef:
-		id = datahandler.FastaRefDatasetID
-	case GffRef:
-		id = datahandler.GFFDatasetID
+func (datahandler *DataHandler) getCurrentDatasetVersion(ctx context.Context, genome *Genome, trackType TrackType, credentials Credentials) (*DatasetVersion, error) {
+	datasetVersion, err := datahandler.Source.GetCurrentDatasetVersion(ctx, genome.datasetID(trackType), credentials)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
 	}
 
-	datasetID := commonmodels.ID{
-		ID: id,
+	return datasetVersion, nil
+}
+
+//getDatasetObjectGroupList Returns all object groups of a specific dataset version
+func (datahandler *DataHandler) getDatasetObjectGroupList(ctx context.Context, trackType TrackType, datasetVersion *DatasetVersion, credentials Credentials) ([]*ObjectGroup, error) {
+	objectGroups, err := datahandler.Source.GetDatasetObjectGroups(ctx, datasetVersion, credentials)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
 	}
 
-	datasetVersion, err := datahandler.GRPCEndpoints.DatasetBackend.GetCurrentVersionOfDataset(datahandler.AutHandler.OutGoingContextFromToken(token, client.UserAPIToken), &datasetID)
+	err = datahandler.applySampleSheet(datasetVersion.DatasetID, objectGroups...)
 	if err != nil {
 		log.Println(err.Error())
 		return nil, err
 	}
 
-	return datasetVersion, nil
+	return objectGroups, nil
 }
 
-//getDatasetObjectGroupList Returns all object groups of a specific dataset version
-func (datahandler *DataHandler) getDatasetObjectGroupList(trackType TrackType, datasetVersion *datasetentrymodels.DatasetVersionEntry, token string) (*datasetapimodels.DatasetObjectGroupList, error) {
-	datasetVersionID := commonmodels.ID{
-		ID: datasetVersion.GetID(),
+//getDatasetDownloadLinks Returns download urls for all object groups of a specific dataset version
+func (datahandler *DataHandler) getDatasetDownloadLinks(ctx context.Context, datasetVersion *DatasetVersion, credentials Credentials) ([]*ObjectGroup, error) {
+	objectGroups, err := datahandler.Source.GetDatasetDownloadLinks(ctx, datasetVersion, credentials)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	if datahandler.Links != nil {
+		datahandler.Links.proxy(objectGroups, datasetVersion.DatasetID, credentials)
 	}
 
-	datasetObjects, err := datahandler.GRPCEndpoints.DatasetBackend.DatasetVersionObjectGroups(datahandler.AutHandler.OutGoingContextFromToken(token, client.UserAPIToken), &datasetVersionID)
+	return objectGroups, nil
+}
+
+//getObjectGroup Returns the download urls for a specific object group
+func (datahandler *DataHandler) getObjectGroup(ctx context.Context, groupID string, credentials Credentials) (*ObjectGroup, error) {
+	objectGroup, err := datahandler.Source.GetObjectGroup(ctx, groupID, credentials)
 	if err != nil {
 		log.Println(err.Error())
 		return nil, err
 	}
 
-	return datasetObjects, nil
+	if datahandler.Links != nil {
+		datahandler.Links.proxy([]*ObjectGroup{objectGroup}, "", credentials)
+	}
+
+	err = datahandler.applySampleSheet(objectGroup.DatasetID, objectGroup)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	return objectGroup, nil
 }
 
-//getDatasetDownloadLinks Returns presigned download urls for a specific dataset version
-func (datahandler *DataHandler) getDatasetDownloadLinks(datasetVersion *datasetentrymodels.DatasetVersionEntry, token string) (*loadmodels.GetDownloadResponse, error) {
-	var requests []*loadmodels.ResourceRequest
+//getPermittedObjectGroup Returns an object group if the user may access it and it belongs to the dataset of the track type
+func (datahandler *DataHandler) getPermittedObjectGroup(ctx context.Context, genome *Genome, trackType TrackType, groupID string, credentials Credentials, permissions *Permissions) (*ObjectGroup, error) {
+	forbidden := &ForbiddenError{
+		TrackType:     trackType,
+		ObjectGroupID: groupID,
+	}
 
-	requests = append(requests, &loadmodels.ResourceRequest{
-		Resource:   commonmodels.Resource_DatasetVersion,
-		ResourceID: datasetVersion.GetID(),
-	})
+	if !permissions.AllowsObjectGroup(trackType, groupID) {
+		return nil, forbidden
+	}
 
-	downloadRequest := loadmodels.GetDownloadRequest{
-		Resource: requests,
+	objectGroup, err := datahandler.getObjectGroup(ctx, groupID, credentials)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
 	}
 
-	groupLinks, err := datahandler.GRPCEndpoints.LoadBackend.GetDownloadLinks(datahandler.AutHandler.OutGoingContextFromToken(token, client.UserAPIToken), &downloadRequest)
+	//Otherwise the access to one dataset could be used to load object groups of another one
+	belongs, err := datahandler.belongsToDataset(ctx, genome, trackType, objectGroup, credentials)
 	if err != nil {
 		log.Println(err.Error())
 		return nil, err
 	}
 
-	return groupLinks, nil
+	if !belongs {
+		return nil, forbidden
+	}
+
+	return objectGroup, nil
 }
 
-//getObjectGroup Returns all presigned download links for a specific dataset version
-func (datahandler *DataHandler) getObjectGroup(groupID string, token string) (*loadmodels.GetDownloadResponse, error) {
-	var requests []*loadmodels.ResourceRequest
+//belongsToDataset Checks if the object group is part of the dataset of the track type
+//If the source does not report the dataset of a group, the group list of the current version is searched
+func (datahandler *DataHandler) belongsToDataset(ctx context.Context, genome *Genome, trackType TrackType, objectGroup *ObjectGroup, credentials Credentials) (bool, error) {
+	if objectGroup.DatasetID != "" {
+		return objectGroup.DatasetID == genome.datasetID(trackType), nil
+	}
+
+	datasetVersion, err := datahandler.getCurrentDatasetVersion(ctx, genome, trackType, credentials)
+	if err != nil {
+		return false, err
+	}
 
-	requests = append(requests, &loadmodels.ResourceRequest{
-		Resource:   commonmodels.Resource_DatasetObjectGroupResource,
-		ResourceID: groupID,
-	})
+	groupList, err := datahandler.getDatasetObjectGroupList(ctx, trackType, datasetVersion, credentials)
+	if err != nil {
+		return false, err
+	}
 
-	downloadRequest := loadmodels.GetDownloadRequest{
-		Resource: requests,
+	for _, group := range groupList {
+		if group.ID == objectGroup.ID {
+			return true, nil
+		}
 	}
 
-	groupLinks, err := datahandler.GRPCEndpoints.LoadBackend.GetDownloadLinks(datahandler.AutHandler.OutGoingContextFromToken(token, client.UserAPIToken), &downloadRequest)
+	return false, nil
+}
+
+//classifyObjectGroup Detects the roles of the files of an object group, file headers are used if the source can read them
+func (datahandler *DataHandler) classifyObjectGroup(objectGroup *ObjectGroup) *ClassifiedGroup {
+	source := datahandler.Source
+	if cache, ok := source.(*CachedSource); ok {
+		source = cache.Source
+	}
+
+	headers, _ := source.(ObjectHeaderReader)
+	return classifyObjectGroup(objectGroup, headers)
+}
+
+//findDataFile Returns the first data file with one of the formats in the object groups of a dataset
+func (datahandler *DataHandler) findDataFile(datasetID string, objectGroups []*ObjectGroup, formats ...FileFormat) (*ClassifiedGroup, *ClassifiedObject, error) {
+	for _, objectGroup := range objectGroups {
+		classifiedGroup := datahandler.classifyObjectGroup(objectGroup)
+		if dataFiles := classifiedGroup.DataFiles(formats...); len(dataFiles) > 0 {
+			return classifiedGroup, dataFiles[0], nil
+		}
+	}
+
+	err := &MissingFileError{
+		Name:    fmt.Sprintf("dataset with id: %v", datasetID),
+		Formats: formats,
+	}
+	log.Println(err.Error())
+	return nil, nil, err
+}
+
+//getTrackFiles Returns the data files with one of the formats of a permitted object group, at least one file is returned
+func (datahandler *DataHandler) getTrackFiles(ctx context.Context, genome *Genome, trackType TrackType, formats []FileFormat, id string, credentials Credentials, permissions *Permissions) (*ClassifiedGroup, []*ClassifiedObject, error) {
+	objectGroup, err := datahandler.getPermittedObjectGroup(ctx, genome, trackType, id, credentials, permissions)
 	if err != nil {
 		log.Println(err.Error())
-		return nil, err
+		return nil, nil, err
+	}
+
+	classifiedGroup := datahandler.classifyObjectGroup(objectGroup)
+	dataFiles := classifiedGroup.DataFiles(formats...)
+	if len(dataFiles) < 1 {
+		err := &MissingFileError{
+			Name:    fmt.Sprintf("object group with id: %v", objectGroup.ID),
+			Formats: formats,
+		}
+		log.Println(err.Error())
+		return nil, nil, err
+	}
+
+	return classifiedGroup, dataFiles, nil
+}
+
+//GetReferenceFasta Returns the FASTA file of the reference dataset of a genome and its index
+func (datahandler *DataHandler) GetReferenceFasta(ctx context.Context, genome *Genome, credentials Credentials) (*ClassifiedObject, *ClassifiedObject, error) {
+	datasetVersion, err := datahandler.getCurrentDatasetVersion(ctx, genome, FastaRef, credentials)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, nil, err
+	}
+
+	refFiles, err := datahandler.getDatasetDownloadLinks(ctx, datasetVersion, credentials)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, nil, err
+	}
+
+	refGroup, fasta, err := datahandler.findDataFile(genome.datasetID(FastaRef), refFiles, FormatFasta)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, nil, err
+	}
+
+	fastaIndex, err := refGroup.IndexFor(fasta)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, nil, err
+	}
+
+	return fasta, fastaIndex, nil
+}
+
+//GetGenome Returns the configured genome with the given id
+func (datahandler *DataHandler) GetGenome(id string) (*Genome, bool) {
+	for _, genome := range datahandler.Genomes {
+		if genome.ID == id {
+			return genome, true
+		}
+	}
+
+	return nil, false
+}
+
+//trackTypeOfDataset Returns the track type for which the dataset id is configured in any genome
+func (datahandler *DataHandler) trackTypeOfDataset(datasetID string) (TrackType, bool) {
+	for _, genome := range datahandler.Genomes {
+		for _, trackType := range datasetConfigKeys {
+			if datasetID != "" && genome.datasetID(trackType) == datasetID {
+				return trackType, true
+			}
+		}
 	}
 
-	return groupLinks, nil
+	return "", false
 }
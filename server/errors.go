@@ -0,0 +1,237 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+//requestIDHeader Header with the id of a request, ids set by a proxy in front of the server are kept
+const requestIDHeader = "X-Request-ID"
+const requestIDContextKey = "requestID"
+
+//requestIDPattern Accepted ids from the request header, other ids are replaced to keep the logs readable
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+//NotFoundError A genome, dataset or object group does not exist
+type NotFoundError struct {
+	Resource string
+	ID       string
+}
+
+func (err *NotFoundError) Error() string {
+	return fmt.Sprintf("%v with id: %v not found", err.Resource, err.ID)
+}
+
+//InvalidDatasetError A configured dataset can not be read, e.g. the id does not refer to a dataset of the backend
+type InvalidDatasetError struct {
+	DatasetID string
+	Reason    string
+}
+
+func (err *InvalidDatasetError) Error() string {
+	return fmt.Sprintf("dataset with id: %v is invalid: %v", err.DatasetID, err.Reason)
+}
+
+//InvalidRequestError The parameters of a request could not be parsed
+type InvalidRequestError struct {
+	Err error
+}
+
+func (err *InvalidRequestError) Error() string {
+	return fmt.Sprintf("invalid request: %v", err.Err.Error())
+}
+
+//Unwrap Returns the parsing error
+func (err *InvalidRequestError) Unwrap() error {
+	return err.Err
+}
+
+//ErrorResponse JSON body of failed requests
+type ErrorResponse struct {
+	Error ErrorDetails `json:"error"`
+}
+
+//ErrorDetails Status, machine readable code and message of a failed request
+//The request id is logged with the error and can be used to find the log entries of a request
+type ErrorDetails struct {
+	Status    int      `json:"status"`
+	Code      string   `json:"code"`
+	Message   string   `json:"message"`
+	Details   []string `json:"details,omitempty"`
+	RequestID string   `json:"requestId"`
+}
+
+//RequestID Assigns an id to every request, the id is returned in the X-Request-ID header
+func RequestID(c *gin.Context) {
+	requestID := c.GetHeader(requestIDHeader)
+	if !requestIDPattern.MatchString(requestID) {
+		var err error
+		requestID, err = randomString(12)
+		if err != nil {
+			log.Println(err.Error())
+			c.AbortWithError(500, err)
+			return
+		}
+	}
+
+	c.Set(requestIDContextKey, requestID)
+	c.Header(requestIDHeader, requestID)
+
+	c.Next()
+}
+
+//requestIDFromGinContext Returns the id assigned by RequestID
+func requestIDFromGinContext(c *gin.Context) string {
+	return c.GetString(requestIDContextKey)
+}
+
+//abortWithDataError Aborts a request that failed in the data handler with the status of the error, forbidden requests are audited
+func abortWithDataError(c *gin.Context, err error) {
+	statusCode, code := errorStatus(err)
+
+	var forbidden *ForbiddenError
+	if errors.As(err, &forbidden) {
+		auditForbidden(c, forbidden)
+		//Anonymous users of the public mode might get access after a login
+		if UserFromGinContext(c) == nil {
+			statusCode, code = 401, "unauthorized"
+		}
+	}
+
+	setRetryAfter(c, err)
+	abortWithErrorResponse(c, statusCode, code, err)
+}
+
+//abortWithErrorResponse Aborts a request with the JSON error body
+//The messages of internal errors are only logged
+func abortWithErrorResponse(c *gin.Context, statusCode int, code string, err error) {
+	requestID := requestIDFromGinContext(c)
+	log.Printf("Request %v failed with status %v: %v", requestID, statusCode, err.Error())
+	c.Error(err)
+
+	details := ErrorDetails{
+		Status:    statusCode,
+		Code:      code,
+		Message:   err.Error(),
+		RequestID: requestID,
+	}
+
+	if statusCode == 500 {
+		details.Message = http.StatusText(statusCode)
+	}
+
+	var sheetErr *SampleSheetError
+	if errors.As(err, &sheetErr) {
+		details.Details = sheetErr.Problems
+	}
+
+	c.AbortWithStatusJSON(statusCode, ErrorResponse{Error: details})
+}
+
+//renderDataError Shows an error page for a page request that failed in the data handler
+func renderDataError(c *gin.Context, err error) {
+	statusCode, _ := errorStatus(err)
+	requestID := requestIDFromGinContext(c)
+	log.Printf("Request %v failed with status %v: %v", requestID, statusCode, err.Error())
+	c.Error(err)
+
+	setRetryAfter(c, err)
+
+	message := err.Error()
+	if statusCode == 500 {
+		message = http.StatusText(statusCode)
+	}
+
+	c.HTML(statusCode, "error.html", gin.H{
+		"Status":    statusCode,
+		"Message":   message,
+		"RequestID": requestID,
+	})
+	c.Abort()
+}
+
+//setRetryAfter Clients can retry after the circuit breaker of the backend is closed again
+func setRetryAfter(c *gin.Context, err error) {
+	var unavailable *BackendUnavailableError
+	if errors.As(err, &unavailable) && unavailable.RetryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(unavailable.RetryAfter.Seconds()))))
+	}
+}
+
+//errorStatus Returns the http status and error code of an error
+//Errors of the BioDataDB that were not converted into typed errors are mapped by their gRPC code
+func errorStatus(err error) (int, string) {
+	var forbidden *ForbiddenError
+	var notFound *NotFoundError
+	var invalidRequest *InvalidRequestError
+	var invalidDataset *InvalidDatasetError
+	var unavailable *BackendUnavailableError
+	var missingFile *MissingFileError
+	var missingIndex *MissingIndexError
+	var sheetErr *SampleSheetError
+
+	switch {
+	case errors.As(err, &forbidden):
+		return 403, "forbidden"
+	case errors.Is(err, errNoCredentials), errors.Is(err, errNotLoggedIn):
+		return 401, "unauthorized"
+	case errors.As(err, &notFound):
+		return 404, "not_found"
+	case errors.As(err, &invalidRequest):
+		return 400, "invalid_request"
+	case errors.As(err, &unavailable):
+		return 503, "backend_unavailable"
+	case errors.As(err, &invalidDataset):
+		return 422, "invalid_dataset"
+	//The request is valid but the object group can not be shown as a track
+	case errors.As(err, &missingFile):
+		return 422, "missing_file"
+	case errors.As(err, &missingIndex):
+		return 422, "missing_index"
+	case errors.As(err, &sheetErr):
+		return 422, "invalid_sample_sheet"
+	case errors.Is(err, context.DeadlineExceeded):
+		return 504, "backend_timeout"
+	}
+
+	code, ok := grpcCode(err)
+	if !ok {
+		return 500, "internal"
+	}
+
+	switch code {
+	case codes.Unauthenticated:
+		return 401, "unauthorized"
+	case codes.PermissionDenied:
+		return 403, "forbidden"
+	case codes.NotFound:
+		return 404, "not_found"
+	case codes.Unavailable:
+		return 503, "backend_unavailable"
+	case codes.DeadlineExceeded:
+		return 504, "backend_timeout"
+	}
+
+	return 502, "backend_error"
+}
+
+//grpcCode Returns the code of a gRPC error that might be wrapped in other errors
+func grpcCode(err error) (codes.Code, bool) {
+	for ; err != nil; err = errors.Unwrap(err) {
+		if grpcErr, ok := err.(interface{ GRPCStatus() *status.Status }); ok {
+			return grpcErr.GRPCStatus().Code(), true
+		}
+	}
+
+	return codes.OK, false
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"log"
+)
+
+//featureFormats Formats of the files in the Features dataset of a genome
+var featureFormats = []FileFormat{FormatBED, FormatBedGraph, FormatNarrowPeak, FormatBroadPeak}
+
+//featureTrackDefaults igv.js defaults for each feature format
+//BED features are colored by strand, peaks are shaded by their score
+var featureTrackDefaults = map[FileFormat]Track{
+	FormatBED: {
+		Type:        "annotation",
+		DisplayMode: "EXPANDED",
+		Color:       "rgb(0, 0, 150)",
+		AltColor:    "rgb(150, 0, 0)",
+	},
+	FormatBedGraph: {
+		Type:      "wig",
+		Color:     "rgb(0, 100, 0)",
+		AutoScale: true,
+	},
+	FormatNarrowPeak: {
+		Type:        "annotation",
+		DisplayMode: "SQUISHED",
+		Color:       "rgb(150, 0, 150)",
+		UseScore:    true,
+	},
+	FormatBroadPeak: {
+		Type:        "annotation",
+		DisplayMode: "SQUISHED",
+		Color:       "rgb(0, 100, 150)",
+		UseScore:    true,
+	},
+}
+
+//GetFeaturesList List of the bed, bedGraph and peak files of a genome
+func (datahandler *DataHandler) GetFeaturesList(ctx context.Context, genome *Genome, credentials Credentials, permissions *Permissions) (map[string][]FileGroup, error) {
+	return datahandler.getFileGroupList(ctx, genome, Features, featureFormats, credentials, permissions)
+}
+
+//GetFeaturesTrack Returns a track for every feature file of an object group with the defaults of its format
+//Compressed files are paired with their tabix index if the group contains one
+func (datahandler *DataHandler) GetFeaturesTrack(ctx context.Context, genome *Genome, id string, credentials Credentials, permissions *Permissions) ([]Track, error) {
+	classifiedGroup, featureFiles, err := datahandler.getTrackFiles(ctx, genome, Features, featureFormats, id, credentials, permissions)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	var tracks []Track
+
+	for _, featureFile := range featureFiles {
+		index, err := classifiedGroup.IndexFor(featureFile)
+		if err != nil {
+			log.Println(err.Error())
+			return nil, err
+		}
+
+		track := featureTrackDefaults[featureFile.Format]
+		track.Format = string(featureFile.Format)
+		track.Name = featureFile.Filename
+		track.URL = featureFile.URL
+
+		if index != nil {
+			track.IndexURL = index.URL
+		}
+
+		tracks = append(tracks, track)
+	}
+
+	return withAttributes(tracks, classifiedGroup.Group.Attributes), nil
+}
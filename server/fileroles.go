@@ -0,0 +1,347 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strings"
+)
+
+//objectHeaderSize Number of bytes that are read from the start of a file to detect its format
+const objectHeaderSize = 4096
+
+//FileRole Role of a file within an object group
+type FileRole string
+
+const (
+	RoleData    FileRole = "data"
+	RoleIndex   FileRole = "index"
+	RoleUnknown FileRole = "unknown"
+)
+
+//FileFormat Format of a data or index file, the names are the igv.js format names where available
+type FileFormat string
+
+const (
+	FormatUnknown    FileFormat = ""
+	FormatFasta      FileFormat = "fasta"
+	FormatGFF3       FileFormat = "gff3"
+	FormatGTF        FileFormat = "gtf"
+	FormatBAM        FileFormat = "bam"
+	FormatCRAM       FileFormat = "cram"
+	FormatBigWig     FileFormat = "bigwig"
+	FormatVCF        FileFormat = "vcf"
+	FormatBED        FileFormat = "bed"
+	FormatBedGraph   FileFormat = "bedgraph"
+	FormatNarrowPeak FileFormat = "narrowpeak"
+	FormatBroadPeak  FileFormat = "broadpeak"
+	FormatFAI        FileFormat = "fai"
+	FormatBAI        FileFormat = "bai"
+	FormatCSI        FileFormat = "csi"
+	FormatTBI        FileFormat = "tbi"
+	FormatCRAI       FileFormat = "crai"
+)
+
+//Compression Compression of a whole file, formats that are always compressed internally (e.g. bam) use CompressionNone
+type Compression string
+
+const (
+	CompressionNone Compression = ""
+	CompressionGzip Compression = "gzip"
+	CompressionBGZF Compression = "bgzf"
+)
+
+var dataFileExtensions = map[string]FileFormat{
+	".fa":         FormatFasta,
+	".fasta":      FormatFasta,
+	".fna":        FormatFasta,
+	".gff":        FormatGFF3,
+	".gff3":       FormatGFF3,
+	".gtf":        FormatGTF,
+	".bam":        FormatBAM,
+	".cram":       FormatCRAM,
+	".bw":         FormatBigWig,
+	".bigwig":     FormatBigWig,
+	".vcf":        FormatVCF,
+	".bed":        FormatBED,
+	".bedgraph":   FormatBedGraph,
+	".bdg":        FormatBedGraph,
+	".narrowpeak": FormatNarrowPeak,
+	".broadpeak":  FormatBroadPeak,
+}
+
+var indexFileExtensions = map[string]FileFormat{
+	".fai":  FormatFAI,
+	".bai":  FormatBAI,
+	".csi":  FormatCSI,
+	".tbi":  FormatTBI,
+	".crai": FormatCRAI,
+}
+
+//ObjectHeaderReader Optionally implemented by a TrackSource that can cheaply read the start of a file
+type ObjectHeaderReader interface {
+	ReadObjectHeader(object *Object, size int) ([]byte, error)
+}
+
+//ClassifiedObject An object with its detected role and format
+type ClassifiedObject struct {
+	*Object
+	Role        FileRole
+	Format      FileFormat
+	Compression Compression
+}
+
+//ClassifiedGroup The objects of an object group sorted by their role
+type ClassifiedGroup struct {
+	Group   *ObjectGroup
+	Data    []*ClassifiedObject
+	Indexes []*ClassifiedObject
+	Unknown []*ClassifiedObject
+}
+
+//MissingFileError An object group or dataset does not contain a data file of the required format
+type MissingFileError struct {
+	Name    string
+	Formats []FileFormat
+}
+
+func (err *MissingFileError) Error() string {
+	return fmt.Sprintf("%v does not contain a file with format: %v", err.Name, err.Formats)
+}
+
+//MissingIndexError A data file that can only be loaded with an index has no matching index in its object group
+type MissingIndexError struct {
+	GroupID  string
+	Filename string
+	Formats  []FileFormat
+}
+
+func (err *MissingIndexError) Error() string {
+	return fmt.Sprintf("no index with format: %v found for file: %v in object group with id: %v", err.Formats, err.Filename, err.GroupID)
+}
+
+//classifyObjectGroup Detects the role of all objects of a group
+//The filename is used first, the file header is only read if headers is not nil
+func classifyObjectGroup(group *ObjectGroup, headers ObjectHeaderReader) *ClassifiedGroup {
+	classifiedGroup := ClassifiedGroup{
+		Group: group,
+	}
+
+	for _, object := range group.Objects {
+		classified := classifyFilename(object)
+
+		if headers != nil {
+			header, err := headers.ReadObjectHeader(object, objectHeaderSize)
+			if err != nil {
+				log.Println(err.Error())
+			} else {
+				sniffHeader(classified, header)
+			}
+		}
+
+		switch classified.Role {
+		case RoleData:
+			classifiedGroup.Data = append(classifiedGroup.Data, classified)
+		case RoleIndex:
+			classifiedGroup.Indexes = append(classifiedGroup.Indexes, classified)
+		default:
+			classifiedGroup.Unknown = append(classifiedGroup.Unknown, classified)
+		}
+	}
+
+	return &classifiedGroup
+}
+
+//classifyFilename Detects role, format and compression from the file extensions, e.g. sample.vcf.gz
+func classifyFilename(object *Object) *ClassifiedObject {
+	classified := ClassifiedObject{
+		Object: object,
+		Role:   RoleUnknown,
+	}
+
+	name := strings.ToLower(object.Filename)
+	switch path.Ext(name) {
+	case ".gz":
+		classified.Compression = CompressionGzip
+		name = strings.TrimSuffix(name, ".gz")
+	case ".bgz", ".bgzf":
+		classified.Compression = CompressionBGZF
+		name = strings.TrimSuffix(name, path.Ext(name))
+	}
+
+	extension := path.Ext(name)
+	if format, ok := indexFileExtensions[extension]; ok {
+		classified.Role = RoleIndex
+		classified.Format = format
+	} else if format, ok := dataFileExtensions[extension]; ok {
+		classified.Role = RoleData
+		classified.Format = format
+	}
+
+	return &classified
+}
+
+//sniffHeader Corrects the classification with the magic bytes of the file, unknown headers are ignored
+func sniffHeader(classified *ClassifiedObject, header []byte) {
+	compression := CompressionNone
+	content := header
+
+	if isGzip(header) {
+		compression = CompressionGzip
+		if isBGZF(header) {
+			compression = CompressionBGZF
+		}
+		content = gunzipPrefix(header)
+	}
+
+	format, role := formatFromMagic(content)
+	switch {
+	case format != FormatUnknown:
+		classified.Format = format
+		classified.Role = role
+	case compression == CompressionNone && classified.Compression != CompressionNone:
+		//A .gz file that is not compressed, e.g. renamed
+		log.Println(fmt.Sprintf("file: %v has a compression suffix but is not compressed", classified.Filename))
+	}
+
+	//BAM, CSI and TBI files are always bgzf compressed
+	if format == FormatBAM || format == FormatCSI || format == FormatTBI {
+		compression = CompressionNone
+	}
+	classified.Compression = compression
+}
+
+//formatFromMagic Detects the format from the first (uncompressed) bytes of a file
+func formatFromMagic(content []byte) (FileFormat, FileRole) {
+	switch {
+	case bytes.HasPrefix(content, []byte("BAM\x01")):
+		return FormatBAM, RoleData
+	case bytes.HasPrefix(content, []byte("CRAM")):
+		return FormatCRAM, RoleData
+	case bytes.HasPrefix(content, []byte{0x26, 0xfc, 0x8f, 0x88}), bytes.HasPrefix(content, []byte{0x88, 0x8f, 0xfc, 0x26}):
+		return FormatBigWig, RoleData
+	case bytes.HasPrefix(content, []byte("##fileformat=VCF")):
+		return FormatVCF, RoleData
+	case bytes.HasPrefix(content, []byte("##gff-version 3")):
+		return FormatGFF3, RoleData
+	case bytes.HasPrefix(content, []byte(">")):
+		return FormatFasta, RoleData
+	case bytes.HasPrefix(content, []byte("BAI\x01")):
+		return FormatBAI, RoleIndex
+	case bytes.HasPrefix(content, []byte("CSI\x01")):
+		return FormatCSI, RoleIndex
+	case bytes.HasPrefix(content, []byte("TBI\x01")):
+		return FormatTBI, RoleIndex
+	default:
+		return FormatUnknown, RoleUnknown
+	}
+}
+
+func isGzip(header []byte) bool {
+	return len(header) >= 3 && header[0] == 0x1f && header[1] == 0x8b && header[2] == 0x08
+}
+
+//isBGZF Checks for the BC extra field of the first bgzf block, see the SAM specification
+func isBGZF(header []byte) bool {
+	return len(header) >= 16 && header[3]&0x04 != 0 && header[12] == 'B' && header[13] == 'C'
+}
+
+//gunzipPrefix Decompresses as much of the start of a gzip file as possible
+func gunzipPrefix(header []byte) []byte {
+	reader, err := gzip.NewReader(bytes.NewReader(header))
+	if err != nil {
+		return nil
+	}
+
+	content := make([]byte, 64)
+	n, _ := io.ReadFull(reader, content)
+	return content[:n]
+}
+
+//DataFiles Returns the data files with one of the given formats
+func (group *ClassifiedGroup) DataFiles(formats ...FileFormat) []*ClassifiedObject {
+	var files []*ClassifiedObject
+	for _, data := range group.Data {
+		for _, format := range formats {
+			if data.Format == format {
+				files = append(files, data)
+				break
+			}
+		}
+	}
+
+	return files
+}
+
+//IndexFor Returns the index of a data file
+//Returns nil if the file does not need an index and has none, or a MissingIndexError if a required index is missing
+func (group *ClassifiedGroup) IndexFor(data *ClassifiedObject) (*ClassifiedObject, error) {
+	formats := indexFormatsFor(data)
+
+	var candidates []*ClassifiedObject
+	for _, index := range group.Indexes {
+		for _, format := range formats {
+			if index.Format == format {
+				candidates = append(candidates, index)
+				break
+			}
+		}
+	}
+
+	//sample.bam.bai and sample.bai both belong to sample.bam
+	dataName := strings.ToLower(data.Filename)
+	dataBaseName := strings.TrimSuffix(dataName, path.Ext(dataName))
+	for _, candidate := range candidates {
+		indexName := strings.ToLower(candidate.Filename)
+		indexBaseName := strings.TrimSuffix(indexName, path.Ext(indexName))
+		if indexBaseName == dataName || indexBaseName == dataBaseName {
+			return candidate, nil
+		}
+	}
+
+	//A single index with a different name is unambiguous if there is only one data file of the same format
+	if len(candidates) == 1 && len(group.DataFiles(data.Format)) == 1 {
+		return candidates[0], nil
+	}
+
+	if !indexRequired(data) {
+		return nil, nil
+	}
+
+	return nil, &MissingIndexError{
+		GroupID:  group.Group.ID,
+		Filename: data.Filename,
+		Formats:  formats,
+	}
+}
+
+//indexFormatsFor Index formats igv.js accepts for a data file
+func indexFormatsFor(data *ClassifiedObject) []FileFormat {
+	switch data.Format {
+	case FormatBAM:
+		return []FileFormat{FormatBAI, FormatCSI}
+	case FormatCRAM:
+		return []FileFormat{FormatCRAI}
+	case FormatFasta:
+		return []FileFormat{FormatFAI}
+	}
+
+	if data.Compression == CompressionBGZF || data.Compression == CompressionGzip {
+		return []FileFormat{FormatTBI, FormatCSI}
+	}
+
+	return nil
+}
+
+//indexRequired Alignment and reference files can not be loaded by igv.js without an index
+func indexRequired(data *ClassifiedObject) bool {
+	switch data.Format {
+	case FormatBAM, FormatCRAM, FormatFasta:
+		return true
+	default:
+		return false
+	}
+}
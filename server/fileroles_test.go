@@ -0,0 +1,100 @@
+package server
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestClassifyFilename(t *testing.T) {
+	tests := []struct {
+		filename        string
+		wantRole        FileRole
+		wantFormat      FileFormat
+		wantCompression Compression
+	}{
+		{filename: "sample.bam", wantRole: RoleData, wantFormat: FormatBAM},
+		{filename: "Sample.BAM", wantRole: RoleData, wantFormat: FormatBAM},
+		{filename: "sample.bam.bai", wantRole: RoleIndex, wantFormat: FormatBAI},
+		{filename: "Sample.BAM.BAI", wantRole: RoleIndex, wantFormat: FormatBAI},
+		{filename: "sample.cram.crai", wantRole: RoleIndex, wantFormat: FormatCRAI},
+		{filename: "genome.fasta.fai", wantRole: RoleIndex, wantFormat: FormatFAI},
+		{filename: "variants.vcf.gz", wantRole: RoleData, wantFormat: FormatVCF, wantCompression: CompressionGzip},
+		{filename: "variants.vcf.bgz", wantRole: RoleData, wantFormat: FormatVCF, wantCompression: CompressionBGZF},
+		{filename: "variants.vcf.gz.tbi", wantRole: RoleIndex, wantFormat: FormatTBI},
+		{filename: "coverage_fwd.bw", wantRole: RoleData, wantFormat: FormatBigWig},
+		{filename: "peaks.narrowPeak", wantRole: RoleData, wantFormat: FormatNarrowPeak},
+		{filename: "README.txt", wantRole: RoleUnknown},
+	}
+
+	for _, test := range tests {
+		t.Run(test.filename, func(t *testing.T) {
+			classified := classifyFilename(&Object{Filename: test.filename})
+			if classified.Role != test.wantRole || classified.Format != test.wantFormat || classified.Compression != test.wantCompression {
+				t.Errorf("got role %q, format %q and compression %q, want %q, %q and %q",
+					classified.Role, classified.Format, classified.Compression, test.wantRole, test.wantFormat, test.wantCompression)
+			}
+		})
+	}
+}
+
+func TestIndexFor(t *testing.T) {
+	tests := []struct {
+		name      string
+		filenames []string
+		data      string
+		wantIndex string
+		wantErr   bool
+	}{
+		{name: "index with data file name", filenames: []string{"a.bam", "a.bam.bai", "b.bam", "b.bam.bai"}, data: "b.bam", wantIndex: "b.bam.bai"},
+		{name: "index without data extension", filenames: []string{"a.bam", "a.bai", "b.bam", "b.bai"}, data: "a.bam", wantIndex: "a.bai"},
+		{name: "upper case index", filenames: []string{"A.BAM", "A.BAM.BAI", "B.BAM", "B.BAM.BAI"}, data: "B.BAM", wantIndex: "B.BAM.BAI"},
+		{name: "upper case index without data extension", filenames: []string{"Sample1.BAM", "Sample1.BAI", "Sample2.bam", "Sample2.bai"}, data: "Sample1.BAM", wantIndex: "Sample1.BAI"},
+		{name: "csi index", filenames: []string{"a.bam", "a.bam.csi"}, data: "a.bam", wantIndex: "a.bam.csi"},
+		{name: "single index with other name", filenames: []string{"a.cram", "other.crai"}, data: "a.cram", wantIndex: "other.crai"},
+		{name: "ambiguous index", filenames: []string{"a.bam", "b.bam", "c.bai"}, data: "a.bam", wantErr: true},
+		{name: "missing fasta index", filenames: []string{"genome.fasta"}, data: "genome.fasta", wantErr: true},
+		{name: "index of another format", filenames: []string{"a.bam", "a.cram.crai"}, data: "a.bam", wantErr: true},
+		{name: "optional index", filenames: []string{"coverage.bw"}, data: "coverage.bw"},
+		{name: "tabix index", filenames: []string{"variants.vcf.gz", "variants.vcf.gz.tbi"}, data: "variants.vcf.gz", wantIndex: "variants.vcf.gz.tbi"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			group := &ObjectGroup{ID: "group"}
+			for _, filename := range test.filenames {
+				group.Objects = append(group.Objects, &Object{ID: filename, Filename: filename})
+			}
+			classified := classifyObjectGroup(group, nil)
+
+			var data *ClassifiedObject
+			for _, dataFile := range classified.Data {
+				if dataFile.Filename == test.data {
+					data = dataFile
+				}
+			}
+			if data == nil {
+				t.Fatalf("%v was not classified as data file", test.data)
+			}
+
+			index, err := classified.IndexFor(data)
+			if test.wantErr {
+				var missingIndex *MissingIndexError
+				if !errors.As(err, &missingIndex) {
+					t.Errorf("got index %+v and error %v, want a MissingIndexError", index, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			gotIndex := ""
+			if index != nil {
+				gotIndex = index.Filename
+			}
+			if gotIndex != test.wantIndex {
+				t.Errorf("got index %q, want %q", gotIndex, test.wantIndex)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+//localFilesPath Route prefix under which the files of the local backend are served
+const localFilesPath = "/files"
+
+//FileEndpoints Serves the track files of the local backend to igv.js
+type FileEndpoints struct {
+	Source      *LocalSource
+	DataHandler DataHandler
+	Access      *AccessPolicy
+}
+
+//GetFile Streams a file below the local backend root
+//Range requests, ETags and If-None-Match are handled by http.ServeContent
+func (endpoints *FileEndpoints) GetFile(c *gin.Context) {
+	requestedPath := c.Param("path")
+
+	for _, segment := range strings.Split(requestedPath, "/") {
+		if segment == ".." {
+			abortWithDataError(c, &InvalidRequestError{Err: fmt.Errorf("path traversal in requested file: %v", requestedPath)})
+			return
+		}
+	}
+
+	//Only files of the configured datasets are served, with the same permissions as their object groups
+	segments := strings.Split(strings.Trim(requestedPath, "/"), "/")
+	trackType, ok := endpoints.DataHandler.trackTypeOfDataset(segments[0])
+	if !ok || len(segments) < 3 {
+		abortWithDataError(c, &NotFoundError{Resource: "file", ID: requestedPath})
+		return
+	}
+
+	groupID := encodeLocalID(segments[0] + "/" + segments[1])
+	if !endpoints.Access.PermissionsFor(UserFromGinContext(c)).AllowsObjectGroup(trackType, groupID) {
+		abortWithDataError(c, &ForbiddenError{TrackType: trackType, ObjectGroupID: groupID})
+		return
+	}
+
+	filePath, err := endpoints.Source.resolve(requestedPath)
+	if err != nil {
+		abortWithDataError(c, &InvalidRequestError{Err: err})
+		return
+	}
+
+	file, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		abortWithDataError(c, &NotFoundError{Resource: "file", ID: requestedPath})
+		return
+	}
+	if err != nil {
+		abortWithDataError(c, err)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		abortWithDataError(c, err)
+		return
+	}
+
+	//Directories are not listed
+	if info.IsDir() {
+		abortWithDataError(c, &NotFoundError{Resource: "file", ID: requestedPath})
+		return
+	}
+
+	c.Header("ETag", fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()))
+	c.Header("Cache-Control", "no-cache")
+
+	http.ServeContent(c.Writer, c.Request, info.Name(), info.ModTime(), file)
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+//newTestFileRouter Serves the files of a local root with the bigwigs dataset of the test genome
+func newTestFileRouter(root string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	fileEndpoints := FileEndpoints{
+		Source: &LocalSource{Root: root},
+		DataHandler: DataHandler{
+			Genomes: []*Genome{{ID: "NC_002942", Datasets: GenomeDatasets{Bigwigs: "bigwigs"}}},
+		},
+		Access: &AccessPolicy{},
+	}
+
+	router := gin.New()
+	router.Use(RequestID)
+	router.GET(localFilesPath+"/*path", fileEndpoints.GetFile)
+
+	return router
+}
+
+func TestFileEndpointsGetFile(t *testing.T) {
+	root, err := ioutil.TempDir("", "files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	outside, err := ioutil.TempDir("", "outside")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outside)
+
+	groupDir := filepath.Join(root, "bigwigs", "sample")
+	err = os.MkdirAll(groupDir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(groupDir, "sample.bw"), []byte("0123456789"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(outside, "secret.bw"), []byte("secret"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink(filepath.Join(outside, "secret.bw"), filepath.Join(groupDir, "secret.bw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := newTestFileRouter(root)
+
+	//The ETag of the file is needed for the conditional request
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest("GET", "/files/bigwigs/sample/sample.bw", nil))
+	etag := response.Header().Get("ETag")
+	if response.Code != 200 || response.Body.String() != "0123456789" || etag == "" {
+		t.Fatalf("got status %v, body %q and etag %q", response.Code, response.Body.String(), etag)
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		headers    map[string]string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "range request", path: "/files/bigwigs/sample/sample.bw", headers: map[string]string{"Range": "bytes=2-5"}, wantStatus: 206, wantBody: "2345"},
+		{name: "matching etag", path: "/files/bigwigs/sample/sample.bw", headers: map[string]string{"If-None-Match": etag}, wantStatus: 304},
+		{name: "other etag", path: "/files/bigwigs/sample/sample.bw", headers: map[string]string{"If-None-Match": `"other"`}, wantStatus: 200, wantBody: "0123456789"},
+		{name: "path traversal", path: "/files/bigwigs/sample/../../../etc/passwd", wantStatus: 400},
+		{name: "symlink outside of the root", path: "/files/bigwigs/sample/secret.bw", wantStatus: 400},
+		{name: "missing file", path: "/files/bigwigs/sample/missing.bw", wantStatus: 404},
+		{name: "directory", path: "/files/bigwigs/sample/", wantStatus: 404},
+		{name: "file of an unknown dataset", path: "/files/other/sample/sample.bw", wantStatus: 404},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest("GET", "/", nil)
+			//The path is set directly, httptest would clean the dot segments
+			request.URL.Path = test.path
+			for header, value := range test.headers {
+				request.Header.Set(header, value)
+			}
+
+			response := httptest.NewRecorder()
+			router.ServeHTTP(response, request)
+
+			if response.Code != test.wantStatus {
+				t.Fatalf("got status %v, want %v: %v", response.Code, test.wantStatus, response.Body.String())
+			}
+			if test.wantBody != "" && response.Body.String() != test.wantBody {
+				t.Errorf("got body %q, want %q", response.Body.String(), test.wantBody)
+			}
+			if response.Code >= 400 && response.Header().Get("Content-Type") != "application/json; charset=utf-8" {
+				t.Errorf("got content type %q for an error", response.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+//TestLocalSourceResolve Paths are kept below the root of the local backend
+func TestLocalSourceResolve(t *testing.T) {
+	source := &LocalSource{Root: testdataRoot}
+
+	filePath, err := source.resolve("../../bigwigs/metadata.tsv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filePath != filepath.Join(testdataRoot, "bigwigs", "metadata.tsv") {
+		t.Errorf("got path %v", filePath)
+	}
+
+	for _, invalidPath := range []string{"", "/", "..", `bigwigs\..\..\server`} {
+		if _, err := source.resolve(invalidPath); err == nil {
+			t.Errorf("path %q was not rejected", invalidPath)
+		}
+	}
+}
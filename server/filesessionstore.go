@@ -0,0 +1,192 @@
+package server
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+//sessionFileSuffix Suffix of the encrypted session files
+const sessionFileSuffix = ".session"
+
+//FileSessionStore Stores every session AES-GCM encrypted in its own file
+//The directory can be placed on a shared volume so that all replicas see the same sessions.
+//Files are named after the hash of the session id, the id itself is never written to disk in plain text.
+type FileSessionStore struct {
+	Dir  string
+	aead cipher.AEAD
+}
+
+//NewFileSessionStoreFromConfig Creates a file session store in Sessions.Dir, the key is read from the SessionKey env var
+func NewFileSessionStoreFromConfig() (*FileSessionStore, error) {
+	dir := viper.GetString("Sessions.Dir")
+	if dir == "" {
+		return nil, fmt.Errorf("Sessions dir needs to be set for the file session store")
+	}
+
+	key := os.Getenv("SessionKey")
+	if key == "" {
+		return nil, fmt.Errorf("SessionKey needs to be set for the file session store")
+	}
+
+	return NewFileSessionStore(dir, key)
+}
+
+//NewFileSessionStore Creates a file session store, the encryption key is derived from the given secret
+func NewFileSessionStore(dir string, secret string) (*FileSessionStore, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileSessionStore{
+		Dir:  dir,
+		aead: aead,
+	}, nil
+}
+
+//Get Reads and decrypts a session
+func (store *FileSessionStore) Get(id string) (*Session, error) {
+	session, err := store.read(store.path(id))
+	if os.IsNotExist(err) {
+		return nil, errSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	//Protects against a file that was copied to the name of another session
+	if session.ID != id {
+		return nil, errSessionNotFound
+	}
+
+	return session, nil
+}
+
+//Save Encrypts and writes a session, the file is replaced atomically
+func (store *FileSessionStore) Save(session *Session) error {
+	plaintext, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, store.aead.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return err
+	}
+
+	ciphertext := store.aead.Seal(nonce, nonce, plaintext, nil)
+
+	tmpFile, err := ioutil.TempFile(store.Dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.Write(ciphertext)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile.Name(), store.path(session.ID))
+}
+
+//Delete Removes the file of a session
+func (store *FileSessionStore) Delete(id string) error {
+	err := os.Remove(store.path(id))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+//DeleteExpired Removes all expired sessions, files that cannot be decrypted are removed as well
+func (store *FileSessionStore) DeleteExpired(expired func(session *Session) bool) error {
+	files, err := ioutil.ReadDir(store.Dir)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), sessionFileSuffix) {
+			continue
+		}
+
+		path := filepath.Join(store.Dir, file.Name())
+		session, err := store.read(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			log.Println(fmt.Sprintf("removing unreadable session file %v: %v", file.Name(), err.Error()))
+		}
+
+		if err != nil || expired(session) {
+			err := os.Remove(path)
+			if err != nil && !os.IsNotExist(err) {
+				log.Println(err.Error())
+			}
+		}
+	}
+
+	return nil
+}
+
+func (store *FileSessionStore) read(path string) (*Session, error) {
+	ciphertext, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	nonceSize := store.aead.NonceSize()
+	if len(ciphertext) < nonceSize {
+		return nil, errors.New("session file is too short")
+	}
+
+	plaintext, err := store.aead.Open(nil, ciphertext[:nonceSize], ciphertext[nonceSize:], nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var session Session
+	err = json.Unmarshal(plaintext, &session)
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+func (store *FileSessionStore) path(id string) string {
+	hash := sha256.Sum256([]byte(id))
+	return filepath.Join(store.Dir, hex.EncodeToString(hash[:])+sessionFileSuffix)
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/spf13/viper"
+)
+
+//defaultGenomeID Used for the genome that is created from the legacy Datasets config section
+const defaultGenomeID = "NC_002942"
+
+//Genome A reference genome, e.g. a Legionella strain, with its own datasets
+type Genome struct {
+	//ID Used in urls and as igv.js genome id, should be the sequence id of the reference
+	ID   string
+	Name string
+	//Datasets IDs of the datasets of the genome, the keys are the same as in the Datasets config section
+	Datasets GenomeDatasets
+}
+
+//GenomeDatasets The dataset ids of a single genome
+type GenomeDatasets struct {
+	Bigwigs       string
+	Bam           string
+	Cram          string
+	Vcf           string
+	Features      string
+	Reference     string
+	GFFAnnotation string
+}
+
+//NewGenomesFromConfig Reads the genomes from the Genomes config section
+//If no genomes are configured, a single genome is created from the Datasets section
+func NewGenomesFromConfig() ([]*Genome, error) {
+	var genomes []*Genome
+	err := viper.UnmarshalKey("Genomes", &genomes)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(genomes) == 0 {
+		var datasets GenomeDatasets
+		err := viper.UnmarshalKey("Datasets", &datasets)
+		if err != nil {
+			return nil, err
+		}
+
+		genomes = append(genomes, &Genome{
+			ID:       defaultGenomeID,
+			Name:     defaultGenomeID,
+			Datasets: datasets,
+		})
+	}
+
+	ids := make(map[string]bool)
+	for _, genome := range genomes {
+		if genome.ID == "" {
+			return nil, fmt.Errorf("genome without id configured")
+		}
+
+		if ids[genome.ID] {
+			return nil, fmt.Errorf("genome with id: %v is configured twice", genome.ID)
+		}
+		ids[genome.ID] = true
+
+		if genome.Name == "" {
+			genome.Name = genome.ID
+		}
+	}
+
+	return genomes, nil
+}
+
+//datasetID Returns the configured dataset id for a specific type of track
+func (genome *Genome) datasetID(trackType TrackType) string {
+	switch trackType {
+	case BigWigs:
+		return genome.Datasets.Bigwigs
+	case BAM:
+		return genome.Datasets.Bam
+	case CRAM:
+		return genome.Datasets.Cram
+	case VCF:
+		return genome.Datasets.Vcf
+	case Features:
+		return genome.Datasets.Features
+	case FastaRef:
+		return genome.Datasets.Reference
+	case GffRef:
+		return genome.Datasets.GFFAnnotation
+	default:
+		return ""
+	}
+}
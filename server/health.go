@@ -0,0 +1,288 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/grpc/connectivity"
+)
+
+//errCheckSkipped Returned by checks that can not run with the current configuration
+var errCheckSkipped = errors.New("check skipped")
+
+//HealthCheck A dependency that is required to serve requests
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+//CheckResult Outcome of a single health check
+type CheckResult struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+//Readiness Outcome of all health checks
+type Readiness struct {
+	Ready   bool          `json:"-"`
+	Status  string        `json:"status"`
+	Checked time.Time     `json:"checked"`
+	Checks  []CheckResult `json:"checks"`
+}
+
+//HealthEndpoints Liveness and readiness probes of the server
+//The results of the readiness checks are cached for CacheTTL, so frequent probes of all replicas do not reach the backend
+type HealthEndpoints struct {
+	Checks []HealthCheck
+	//CacheTTL Lifetime of the readiness results
+	CacheTTL time.Duration
+	//Timeout Deadline of all checks of a probe
+	Timeout time.Duration
+
+	mutex     sync.Mutex
+	readiness *Readiness
+	probes    singleflight.Group
+}
+
+//NewHealthEndpointsFromConfig Creates the probes configured in the Health section
+func NewHealthEndpointsFromConfig(checks ...HealthCheck) *HealthEndpoints {
+	viper.SetDefault("Health.CacheTTL", "10s")
+	viper.SetDefault("Health.Timeout", "5s")
+
+	return &HealthEndpoints{
+		Checks:   checks,
+		CacheTTL: viper.GetDuration("Health.CacheTTL"),
+		Timeout:  viper.GetDuration("Health.Timeout"),
+	}
+}
+
+//Liveness Responds as long as the server handles requests, the dependencies are not checked
+//Otherwise an outage of the backend would restart all replicas
+func (health *HealthEndpoints) Liveness(c *gin.Context) {
+	c.JSON(200, gin.H{"status": "ok"})
+}
+
+//Readiness Responds with 200 if all checks pass and 503 otherwise
+func (health *HealthEndpoints) Readiness(c *gin.Context) {
+	readiness := health.check()
+	if !readiness.Ready {
+		c.JSON(503, readiness)
+		return
+	}
+
+	c.JSON(200, readiness)
+}
+
+//check Returns the cached readiness or runs the checks once for all concurrent probes
+func (health *HealthEndpoints) check() *Readiness {
+	health.mutex.Lock()
+	cached := health.readiness
+	health.mutex.Unlock()
+
+	if cached != nil && time.Since(cached.Checked) < health.CacheTTL {
+		return cached
+	}
+
+	value, _, _ := health.probes.Do("readiness", func() (interface{}, error) {
+		readiness := health.runChecks()
+
+		health.mutex.Lock()
+		health.readiness = readiness
+		health.mutex.Unlock()
+
+		return readiness, nil
+	})
+
+	return value.(*Readiness)
+}
+
+//runChecks Runs all checks concurrently, the probe is not bound to a request to share the result
+func (health *HealthEndpoints) runChecks() *Readiness {
+	ctx := context.Background()
+	if health.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, health.Timeout)
+		defer cancel()
+	}
+
+	results := make([]CheckResult, len(health.Checks))
+
+	var wg sync.WaitGroup
+	for i, check := range health.Checks {
+		wg.Add(1)
+		go func(i int, check HealthCheck) {
+			defer wg.Done()
+
+			start := time.Now()
+			err := check.Check(ctx)
+
+			result := CheckResult{
+				Name:     check.Name,
+				Status:   "ok",
+				Duration: time.Since(start).Round(time.Millisecond).String(),
+			}
+
+			switch {
+			case errors.Is(err, errCheckSkipped):
+				result.Status = "skipped"
+				result.Error = err.Error()
+			case err != nil:
+				log.Printf("Readiness check %v failed: %v", check.Name, err.Error())
+				result.Status = "failed"
+				result.Error = err.Error()
+			}
+
+			results[i] = result
+		}(i, check)
+	}
+	wg.Wait()
+
+	readiness := Readiness{
+		Ready:   true,
+		Status:  "ready",
+		Checked: time.Now(),
+		Checks:  results,
+	}
+
+	for _, result := range results {
+		if result.Status == "failed" {
+			readiness.Ready = false
+			readiness.Status = "unavailable"
+		}
+	}
+
+	return &readiness
+}
+
+//grpcConnection The state of a gRPC connection, implemented by grpc.ClientConn
+type grpcConnection interface {
+	GetState() connectivity.State
+	WaitForStateChange(ctx context.Context, state connectivity.State) bool
+}
+
+//grpcConnectionCheck Waits until the connection to the BioDataDB is ready
+//The connection is established in the background, a connection that failed is reported directly.
+//An idle connection is reachable: it has no open transport because there were no calls for a while and connects on the next call.
+func grpcConnectionCheck(conn grpcConnection) HealthCheck {
+	return HealthCheck{
+		Name: "biodatadb",
+		Check: func(ctx context.Context) error {
+			for {
+				state := conn.GetState()
+				switch state {
+				case connectivity.Ready, connectivity.Idle:
+					return nil
+				case connectivity.TransientFailure, connectivity.Shutdown:
+					return fmt.Errorf("connection to the BioDataDB is in state %v", state)
+				}
+
+				if !conn.WaitForStateChange(ctx, state) {
+					return fmt.Errorf("connection to the BioDataDB is still in state %v: %v", state, ctx.Err())
+				}
+			}
+		},
+	}
+}
+
+//datasetsCheck Checks that the current version of every configured dataset can be resolved with the service token
+//The source is used without the cache, otherwise an outage would only be noticed after the cached versions expire
+func datasetsCheck(source TrackSource, genomes []*Genome, credentials Credentials) HealthCheck {
+	if cache, ok := source.(*CachedSource); ok {
+		source = cache.Source
+	}
+
+	_, local := source.(*LocalSource)
+
+	return HealthCheck{
+		Name: "datasets",
+		Check: func(ctx context.Context) error {
+			//The local backend does not need credentials
+			if credentials.Token == "" && !local {
+				return fmt.Errorf("%w: no service token for the token strategy", errCheckSkipped)
+			}
+
+			datasetIDs := make(map[string]bool)
+			for _, genome := range genomes {
+				for _, trackType := range datasetConfigKeys {
+					if datasetID := genome.datasetID(trackType); datasetID != "" {
+						datasetIDs[datasetID] = true
+					}
+				}
+			}
+
+			group, groupCtx := errgroup.WithContext(ctx)
+			for datasetID := range datasetIDs {
+				datasetID := datasetID
+				group.Go(func() error {
+					_, err := source.GetCurrentDatasetVersion(groupCtx, datasetID, credentials)
+					if err != nil {
+						return fmt.Errorf("current version of dataset %v: %v", datasetID, err.Error())
+					}
+					return nil
+				})
+			}
+
+			return group.Wait()
+		},
+	}
+}
+
+//oidcCheck Checks that the discovery document and the keys of the OIDC issuer can be loaded
+func oidcCheck(issuerURL string, httpClient *http.Client) HealthCheck {
+	return HealthCheck{
+		Name: "oidc",
+		Check: func(ctx context.Context) error {
+			if issuerURL == "" {
+				return fmt.Errorf("%w: no issuer configured", errCheckSkipped)
+			}
+
+			var discovery struct {
+				JWKSURL string `json:"jwks_uri"`
+			}
+			err := getJSON(ctx, httpClient, strings.TrimSuffix(issuerURL, "/")+"/.well-known/openid-configuration", &discovery)
+			if err != nil {
+				return err
+			}
+
+			if discovery.JWKSURL == "" {
+				return fmt.Errorf("discovery document of %v does not contain a jwks_uri", issuerURL)
+			}
+
+			var keys json.RawMessage
+			return getJSON(ctx, httpClient, discovery.JWKSURL, &keys)
+		},
+	}
+}
+
+//getJSON Decodes the JSON response of a GET request, other status codes than 200 are returned as error
+func getJSON(ctx context.Context, httpClient *http.Client, url string, value interface{}) error {
+	request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		return fmt.Errorf("%v responded with status %v", url, response.StatusCode)
+	}
+
+	return json.NewDecoder(response.Body).Decode(value)
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/connectivity"
+)
+
+//fakeConnection Goes through the states one after another, the last state does not change anymore
+type fakeConnection struct {
+	states []connectivity.State
+}
+
+func (conn *fakeConnection) GetState() connectivity.State {
+	return conn.states[0]
+}
+
+func (conn *fakeConnection) WaitForStateChange(ctx context.Context, state connectivity.State) bool {
+	if len(conn.states) == 1 {
+		<-ctx.Done()
+		return false
+	}
+
+	conn.states = conn.states[1:]
+	return true
+}
+
+func TestGRPCConnectionCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		states  []connectivity.State
+		wantErr bool
+	}{
+		{name: "ready", states: []connectivity.State{connectivity.Ready}},
+		{name: "idle", states: []connectivity.State{connectivity.Idle}},
+		{name: "connected", states: []connectivity.State{connectivity.Connecting, connectivity.Ready}},
+		{name: "connection failed", states: []connectivity.State{connectivity.Connecting, connectivity.TransientFailure}, wantErr: true},
+		{name: "still connecting", states: []connectivity.State{connectivity.Connecting}, wantErr: true},
+		{name: "shutdown", states: []connectivity.State{connectivity.Shutdown}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+
+			err := grpcConnectionCheck(&fakeConnection{states: test.states}).Check(ctx)
+			if test.wantErr && err == nil {
+				t.Error("got no error, want an error")
+			}
+			if !test.wantErr && err != nil {
+				t.Errorf("got error %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,491 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+//IGVSessionImport Result of an igv.js session import
+//Unmapped lists the names or urls of the tracks that could not be found in the datasets of the genome
+type IGVSessionImport struct {
+	Session  *BrowserSession `json:"session"`
+	Unmapped []string        `json:"unmapped"`
+}
+
+//igvSession The parts of an igv.js or igv-webapp session that can be imported
+//https://github.com/igvteam/igv.js/wiki/Browser-Configuration-2.0
+type igvSession struct {
+	Genome    json.RawMessage   `json:"genome"`
+	Reference *igvReference     `json:"reference"`
+	Locus     json.RawMessage   `json:"locus"`
+	Tracks    []igvSessionTrack `json:"tracks"`
+}
+
+type igvReference struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+//igvSessionTrack A track of an igv.js session, only the settings that are stored in a saved view are read
+type igvSessionTrack struct {
+	Name        string            `json:"name"`
+	URL         json.RawMessage   `json:"url"`
+	Type        string            `json:"type"`
+	Color       string            `json:"color"`
+	AltColor    string            `json:"altColor"`
+	DisplayMode string            `json:"displayMode"`
+	Height      float64           `json:"height"`
+	Min         *float64          `json:"min"`
+	Max         *float64          `json:"max"`
+	AutoScale   *bool             `json:"autoscale"`
+	ColorBy     json.RawMessage   `json:"colorBy"`
+	Tracks      []igvSessionTrack `json:"tracks"`
+}
+
+//ExportIGVSession Returns a saved view as igv.js session that can be loaded in igv-webapp or igv.js
+//The track urls are created with the permissions of the requesting user, tracks the user can not access are left out
+func (endpoints *BrowserSessionEndpoints) ExportIGVSession(c *gin.Context) {
+	session, ok := endpoints.load(c)
+	if !ok {
+		return
+	}
+
+	genome, ok := endpoints.DataHandler.GetGenome(session.Genome)
+	if !ok {
+		abortWithDataError(c, &NotFoundError{Resource: "genome", ID: session.Genome})
+		return
+	}
+
+	credentials, err := endpoints.Browser.AutHandler.CredentialsFromGinContext(c)
+	if err != nil {
+		abortWithDataError(c, err)
+		return
+	}
+
+	permissions := endpoints.Browser.Access.PermissionsFor(UserFromGinContext(c))
+	igvBrowser, err := endpoints.Browser.defaultBrowser(c.Request.Context(), genome, credentials, permissions)
+	if err != nil {
+		abortWithDataError(c, err)
+		return
+	}
+
+	igvBrowser.Name = session.Name
+	igvBrowser.Locus = session.Locus
+
+	for _, sessionTrack := range session.Tracks {
+		tracks, err := endpoints.Browser.loadSessionTrack(c.Request.Context(), genome, sessionTrack, credentials, permissions)
+		switch err.(type) {
+		case nil:
+		case *ForbiddenError, *MissingFileError, *MissingIndexError:
+			log.Println(fmt.Sprintf("Skipping track %v with id: %v of browser session: %v", sessionTrack.Kind, sessionTrack.ID, session.ID))
+			continue
+		default:
+			abortWithDataError(c, err)
+			return
+		}
+
+		for _, track := range tracks {
+			igvBrowser.Tracks = append(igvBrowser.Tracks, applyTrackSettings(track, sessionTrack.Settings))
+		}
+	}
+
+	//Stable urls need the session cookie of the dashboard, exports are opened in other applications
+	if links := endpoints.DataHandler.Links; links != nil {
+		igvBrowser.Reference.FastaURL = links.Direct(igvBrowser.Reference.FastaURL, credentials)
+		igvBrowser.Reference.IndexURL = links.Direct(igvBrowser.Reference.IndexURL, credentials)
+		links.directTracks(igvBrowser.Reference.Tracks, credentials)
+		links.directTracks(igvBrowser.Tracks, credentials)
+	}
+
+	//Urls of the dashboard, e.g. files of the local backend, are resolved against the origin of the export
+	baseURL := endpoints.externalURL(c)
+	igvBrowser.Reference.FastaURL = absoluteURL(baseURL, igvBrowser.Reference.FastaURL)
+	igvBrowser.Reference.IndexURL = absoluteURL(baseURL, igvBrowser.Reference.IndexURL)
+	absoluteTrackURLs(baseURL, igvBrowser.Reference.Tracks)
+	absoluteTrackURLs(baseURL, igvBrowser.Tracks)
+
+	c.JSON(200, igvBrowser)
+}
+
+//externalURL Returns the configured base url of the dashboard or the scheme and host of the request
+func (endpoints *BrowserSessionEndpoints) externalURL(c *gin.Context) string {
+	if endpoints.ExternalURL != "" {
+		return strings.TrimSuffix(endpoints.ExternalURL, "/")
+	}
+
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	//TLS is usually terminated by the ingress
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+
+	return scheme + "://" + c.Request.Host
+}
+
+//absoluteURL Prefixes urls relative to the dashboard with the base url, absolute urls are returned unchanged
+func absoluteURL(baseURL string, rawURL string) string {
+	if !strings.HasPrefix(rawURL, "/") || strings.HasPrefix(rawURL, "//") {
+		return rawURL
+	}
+
+	return baseURL + rawURL
+}
+
+//absoluteTrackURLs Replaces the relative urls of the tracks and their sub tracks with absolute urls
+func absoluteTrackURLs(baseURL string, tracks []Track) {
+	for i := range tracks {
+		tracks[i].URL = absoluteURL(baseURL, tracks[i].URL)
+		tracks[i].IndexURL = absoluteURL(baseURL, tracks[i].IndexURL)
+		absoluteTrackURLs(baseURL, tracks[i].Tracks)
+	}
+}
+
+//ImportIGVSession Saves an igv.js session as new view of the logged in user
+//The genome is taken from the genome id of the session or the genome query parameter, the tracks are mapped back to object groups by their urls
+func (endpoints *BrowserSessionEndpoints) ImportIGVSession(c *gin.Context) {
+	user := UserFromGinContext(c)
+	if user == nil {
+		abortWithDataError(c, errNotLoggedIn)
+		return
+	}
+
+	var igvSessionData igvSession
+	err := c.ShouldBindJSON(&igvSessionData)
+	if err != nil {
+		abortWithDataError(c, &InvalidRequestError{Err: err})
+		return
+	}
+
+	genome, err := endpoints.importGenome(&igvSessionData, c.Query("genome"))
+	if err != nil {
+		abortWithDataError(c, &InvalidRequestError{Err: err})
+		return
+	}
+
+	credentials, err := endpoints.Browser.AutHandler.CredentialsFromGinContext(c)
+	if err != nil {
+		abortWithDataError(c, err)
+		return
+	}
+
+	index, err := endpoints.DataHandler.objectIndex(c.Request.Context(), genome, credentials, endpoints.Browser.Access.PermissionsFor(user))
+	if err != nil {
+		abortWithDataError(c, err)
+		return
+	}
+
+	session := &BrowserSession{
+		Name:   strings.TrimSpace(c.Query("name")),
+		Genome: genome.ID,
+		Locus:  parseIGVLocus(igvSessionData.Locus),
+	}
+
+	result := IGVSessionImport{
+		Session:  session,
+		Unmapped: make([]string, 0),
+	}
+
+	imported := make(map[string]bool)
+	for _, igvTrack := range igvSessionData.Tracks {
+		sessionTrack, ok := index.find(igvTrack)
+		if !ok {
+			//The reference sequence and annotation are part of every view
+			if igvTrack.Type != "sequence" && igvTrack.Type != "annotation" {
+				result.Unmapped = append(result.Unmapped, igvTrack.label())
+			}
+			continue
+		}
+
+		key := sessionTrack.Kind + "/" + sessionTrack.ID
+		if imported[key] {
+			continue
+		}
+		imported[key] = true
+
+		sessionTrack.Settings = igvTrack.settings()
+		session.Tracks = append(session.Tracks, sessionTrack)
+	}
+
+	if session.Name == "" {
+		session.Name = "Imported igv.js session"
+	}
+
+	err = endpoints.validate(session)
+	if err != nil {
+		abortWithDataError(c, &InvalidRequestError{Err: err})
+		return
+	}
+
+	err = endpoints.saveNew(session, user)
+	if err != nil {
+		abortWithDataError(c, err)
+		return
+	}
+
+	c.JSON(201, result)
+}
+
+//importGenome Finds the configured genome of an igv.js session, genomeID is used if the genome of the session is not configured
+func (endpoints *BrowserSessionEndpoints) importGenome(session *igvSession, genomeID string) (*Genome, error) {
+	var candidates []string
+
+	var genomeName string
+	if json.Unmarshal(session.Genome, &genomeName) == nil && genomeName != "" {
+		candidates = append(candidates, genomeName)
+	}
+
+	if session.Reference != nil {
+		candidates = append(candidates, session.Reference.ID, session.Reference.Name)
+	}
+
+	if genomeID != "" {
+		candidates = append(candidates, genomeID)
+	}
+
+	for _, candidate := range candidates {
+		if genome, ok := endpoints.DataHandler.GetGenome(candidate); ok {
+			return genome, nil
+		}
+	}
+
+	if genomeID == "" && len(endpoints.DataHandler.Genomes) == 1 {
+		return endpoints.DataHandler.Genomes[0], nil
+	}
+
+	return nil, fmt.Errorf("could not find the genome of the igv.js session, set the genome query parameter")
+}
+
+//parseIGVLocus Returns the locus of an igv.js session, multiple loci are separated by spaces
+func parseIGVLocus(locus json.RawMessage) string {
+	var single string
+	if json.Unmarshal(locus, &single) == nil {
+		return single
+	}
+
+	var multiple []string
+	if json.Unmarshal(locus, &multiple) == nil {
+		return strings.Join(multiple, " ")
+	}
+
+	return ""
+}
+
+//urls Returns the urls of the track and of the tracks of a merged track
+func (igvTrack *igvSessionTrack) urls() []string {
+	var urls []string
+
+	var trackURL string
+	if json.Unmarshal(igvTrack.URL, &trackURL) == nil && trackURL != "" {
+		urls = append(urls, trackURL)
+	}
+
+	for _, subTrack := range igvTrack.Tracks {
+		urls = append(urls, subTrack.urls()...)
+	}
+
+	return urls
+}
+
+//label Name of the track in the list of unmapped tracks
+func (igvTrack *igvSessionTrack) label() string {
+	if igvTrack.Name != "" {
+		return igvTrack.Name
+	}
+
+	if urls := igvTrack.urls(); len(urls) > 0 {
+		return urls[0]
+	}
+
+	return "unnamed track"
+}
+
+//settings Returns the settings of an igv.js track that are kept in a saved view
+func (igvTrack *igvSessionTrack) settings() TrackSettings {
+	settings := TrackSettings{
+		Color:       igvTrack.Color,
+		AltColor:    igvTrack.AltColor,
+		DisplayMode: igvTrack.DisplayMode,
+		Height:      int(math.Round(igvTrack.Height)),
+		AutoScale:   igvTrack.AutoScale,
+	}
+
+	if igvTrack.AutoScale == nil || !*igvTrack.AutoScale {
+		settings.Min = igvTrack.Min
+		settings.Max = igvTrack.Max
+	}
+
+	//Newer igv.js versions use objects for some colorBy options, only INFO field names are kept
+	var colorBy string
+	if json.Unmarshal(igvTrack.ColorBy, &colorBy) == nil {
+		settings.ColorBy = colorBy
+	}
+
+	return settings
+}
+
+//applyTrackSettings Replaces the default config of a track with the settings of a saved view
+func applyTrackSettings(track Track, settings TrackSettings) Track {
+	if settings.Name != "" {
+		track.Name = settings.Name
+	}
+	if settings.Color != "" {
+		track.Color = settings.Color
+	}
+	if settings.AltColor != "" {
+		track.AltColor = settings.AltColor
+	}
+	if settings.DisplayMode != "" {
+		track.DisplayMode = settings.DisplayMode
+	}
+	if settings.Height > 0 {
+		track.Height = settings.Height
+	}
+	if settings.AutoScale != nil {
+		track.AutoScale = *settings.AutoScale
+	}
+	if settings.ColorBy != "" {
+		track.ColorBy = settings.ColorBy
+	}
+	if settings.Min != nil || settings.Max != nil {
+		track.Min = settings.Min
+		track.Max = settings.Max
+		track.AutoScale = false
+	}
+
+	return track
+}
+
+//loadSessionTrack Loads the tracks of an object group of a saved view
+func (browser *BrowserEndpoints) loadSessionTrack(ctx context.Context, genome *Genome, sessionTrack SessionTrack, credentials Credentials, permissions *Permissions) ([]Track, error) {
+	switch sessionTrack.Kind {
+	case "bigWigsTrack":
+		return browser.DataHandler.GetBigWigsTrack(ctx, genome, sessionTrack.ID, credentials, permissions)
+	case "bamTrack":
+		return browser.DataHandler.GetBamTrack(ctx, genome, sessionTrack.ID, credentials, permissions)
+	case "cramTrack":
+		return browser.DataHandler.GetCramTrack(ctx, genome, sessionTrack.ID, credentials, permissions)
+	case "featuresTrack":
+		return browser.DataHandler.GetFeaturesTrack(ctx, genome, sessionTrack.ID, credentials, permissions)
+	case "vcfTrack":
+		options := VariantOptions{
+			ColorBy: sessionTrack.Settings.ColorBy,
+			Samples: parseSampleNames(sessionTrack.Settings.Samples),
+		}
+		return browser.DataHandler.GetVcfTrack(ctx, genome, sessionTrack.ID, credentials, permissions, options)
+	default:
+		return nil, fmt.Errorf("unknown track kind: %v", sessionTrack.Kind)
+	}
+}
+
+//objectIndex Finds the object groups of a genome by the urls and filenames of their files
+type objectIndex struct {
+	byPath     map[string]SessionTrack
+	byFilename map[string][]SessionTrack
+}
+
+//objectIndex Indexes the files of all permitted object groups of the track datasets of a genome
+//The download links of the datasets are requested concurrently and are not handed out, so they are not registered in the link proxy
+func (datahandler *DataHandler) objectIndex(ctx context.Context, genome *Genome, credentials Credentials, permissions *Permissions) (*objectIndex, error) {
+	index := &objectIndex{
+		byPath:     make(map[string]SessionTrack),
+		byFilename: make(map[string][]SessionTrack),
+	}
+
+	kinds := make([]string, 0, len(trackKinds))
+	for kind := range trackKinds {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	var calls []datasetCall
+	objectGroupsByKind := make([][]*ObjectGroup, len(kinds))
+	for i, kind := range kinds {
+		i, trackType := i, trackKinds[kind]
+		if genome.datasetID(trackType) == "" || !permissions.AllowsAnyObjectGroup(trackType) {
+			continue
+		}
+
+		calls = append(calls, datasetCall{TrackType: trackType, Call: func(ctx context.Context) error {
+			datasetVersion, err := datahandler.getCurrentDatasetVersion(ctx, genome, trackType, credentials)
+			if err != nil {
+				return err
+			}
+
+			objectGroupsByKind[i], err = datahandler.Source.GetDatasetDownloadLinks(ctx, datasetVersion, credentials)
+			return err
+		}})
+	}
+
+	err := datahandler.runDatasetCalls(ctx, genome, calls...)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	for i, kind := range kinds {
+		trackType := trackKinds[kind]
+
+		for _, objectGroup := range objectGroupsByKind[i] {
+			if !permissions.AllowsObjectGroup(trackType, objectGroup.ID) {
+				continue
+			}
+
+			sessionTrack := SessionTrack{Kind: kind, ID: objectGroup.ID}
+			for _, object := range objectGroup.Objects {
+				//Exports contain the download links, the browser the stable urls of the link proxy
+				if objectPath := urlPath(object.URL); objectPath != "" {
+					index.byPath[objectPath] = sessionTrack
+				}
+				if datahandler.Links != nil {
+					index.byPath[urlPath(stableURL(objectGroup.ID, object))] = sessionTrack
+				}
+				index.byFilename[object.Filename] = append(index.byFilename[object.Filename], sessionTrack)
+			}
+		}
+	}
+
+	return index, nil
+}
+
+//find Returns the object group of a track, urls are compared without host and query because download links expire
+//Filenames are only used if they are unique in the genome
+func (index *objectIndex) find(igvTrack igvSessionTrack) (SessionTrack, bool) {
+	urls := igvTrack.urls()
+
+	for _, trackURL := range urls {
+		if sessionTrack, ok := index.byPath[urlPath(trackURL)]; ok {
+			return sessionTrack, true
+		}
+	}
+
+	for _, trackURL := range urls {
+		filename := path.Base(urlPath(trackURL))
+		if sessionTracks := index.byFilename[filename]; len(sessionTracks) == 1 {
+			return sessionTracks[0], true
+		}
+	}
+
+	return SessionTrack{}, false
+}
+
+//urlPath Returns the unescaped path of an url
+func urlPath(rawURL string) string {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+
+	return parsedURL.Path
+}
@@ -0,0 +1,315 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+//linksPath Route prefix of the stable track urls
+const linksPath = "/t"
+
+//streamedHeaders Headers that are passed between igv.js and the storage if the files are streamed
+var streamedHeaders = []string{"Range", "If-None-Match", "If-Modified-Since", "If-Range"}
+var streamedResponseHeaders = []string{"Accept-Ranges", "Content-Length", "Content-Range", "Content-Type", "Content-Encoding", "ETag", "Last-Modified"}
+
+//LinkProxy Replaces the presigned download links of the BioDataDB with stable urls under /t/<object group id>/<object id>/<filename>
+//The presigned links are kept until they expire and are requested again with the credentials of the user afterwards
+type LinkProxy struct {
+	//DefaultTTL Lifetime of links without a recognised expiry
+	DefaultTTL time.Duration
+	//RefreshMargin Links are signed again if they expire within the margin
+	RefreshMargin time.Duration
+	//Stream Streams the files through the server instead of redirecting to the presigned links
+	Stream bool
+	Client *http.Client
+
+	mutex sync.Mutex
+	//links Presigned links by credentials, object group and object
+	links map[string]signedLink
+	//datasets Dataset ids of the object groups, used to check the permissions of a request
+	datasets map[string]string
+}
+
+//signedLink A presigned link and the time it expires
+type signedLink struct {
+	URL     string
+	Expires time.Time
+}
+
+//NewLinkProxyFromConfig Creates the link proxy configured in the Links section
+func NewLinkProxyFromConfig() *LinkProxy {
+	viper.SetDefault("Links.DefaultTTL", "15m")
+	viper.SetDefault("Links.RefreshMargin", "1m")
+
+	return &LinkProxy{
+		DefaultTTL:    viper.GetDuration("Links.DefaultTTL"),
+		RefreshMargin: viper.GetDuration("Links.RefreshMargin"),
+		Stream:        viper.GetBool("Links.Stream"),
+		Client:        &http.Client{},
+		links:         make(map[string]signedLink),
+		datasets:      make(map[string]string),
+	}
+}
+
+//proxy Stores the presigned links of the object groups and replaces them with stable urls
+//datasetID is used for groups for which the source does not report their dataset
+func (proxy *LinkProxy) proxy(objectGroups []*ObjectGroup, datasetID string, credentials Credentials) {
+	now := time.Now()
+
+	proxy.mutex.Lock()
+	defer proxy.mutex.Unlock()
+
+	for _, objectGroup := range objectGroups {
+		groupDatasetID := objectGroup.DatasetID
+		if groupDatasetID == "" {
+			groupDatasetID = datasetID
+		}
+		if groupDatasetID != "" {
+			proxy.datasets[objectGroup.ID] = groupDatasetID
+		}
+
+		for _, object := range objectGroup.Objects {
+			if object.URL == "" {
+				continue
+			}
+
+			expires, ok := linkExpiry(object.URL)
+			if !ok {
+				expires = now.Add(proxy.DefaultTTL)
+			}
+
+			proxy.links[linkKey(credentials, objectGroup.ID, object.ID)] = signedLink{
+				URL:     object.URL,
+				Expires: expires,
+			}
+			object.URL = stableURL(objectGroup.ID, object)
+		}
+	}
+}
+
+//signed Returns the presigned link of an object if it does not expire within the refresh margin
+func (proxy *LinkProxy) signed(credentials Credentials, groupID string, objectID string) (string, bool) {
+	proxy.mutex.Lock()
+	defer proxy.mutex.Unlock()
+
+	link, ok := proxy.links[linkKey(credentials, groupID, objectID)]
+	if !ok || time.Now().Add(proxy.RefreshMargin).After(link.Expires) {
+		return "", false
+	}
+
+	return link.URL, true
+}
+
+//datasetOf Returns the dataset id of an object group whose links have been handed out
+func (proxy *LinkProxy) datasetOf(groupID string) (string, bool) {
+	proxy.mutex.Lock()
+	defer proxy.mutex.Unlock()
+
+	datasetID, ok := proxy.datasets[groupID]
+	return datasetID, ok
+}
+
+//Direct Returns the presigned link behind a stable url, other urls are returned unchanged
+//Used for exports that are opened outside of the dashboard, e.g. in igv-webapp
+func (proxy *LinkProxy) Direct(rawURL string, credentials Credentials) string {
+	segments := strings.SplitN(strings.TrimPrefix(urlPath(rawURL), linksPath+"/"), "/", 3)
+	if !strings.HasPrefix(rawURL, linksPath+"/") || len(segments) != 3 {
+		return rawURL
+	}
+
+	link, ok := proxy.signed(credentials, segments[0], segments[1])
+	if !ok {
+		return rawURL
+	}
+
+	return link
+}
+
+//directTracks Replaces the stable urls of the tracks with their presigned links
+func (proxy *LinkProxy) directTracks(tracks []Track, credentials Credentials) {
+	for i := range tracks {
+		tracks[i].URL = proxy.Direct(tracks[i].URL, credentials)
+		tracks[i].IndexURL = proxy.Direct(tracks[i].IndexURL, credentials)
+		proxy.directTracks(tracks[i].Tracks, credentials)
+	}
+}
+
+//CleanupPeriodically Removes expired links in the given interval, blocks forever
+func (proxy *LinkProxy) CleanupPeriodically(interval time.Duration) {
+	for range time.Tick(interval) {
+		now := time.Now()
+
+		proxy.mutex.Lock()
+		for key, link := range proxy.links {
+			if now.After(link.Expires) {
+				delete(proxy.links, key)
+			}
+		}
+		proxy.mutex.Unlock()
+	}
+}
+
+//linkKey Presigned links are only handed out to requests with the credentials they were created for
+func linkKey(credentials Credentials, groupID string, objectID string) string {
+	return tokenScope(credentials) + "/" + groupID + "/" + objectID
+}
+
+//stableURL Returns the url of an object that does not expire
+//The filename is not used by the server, igv.js detects the compression and index type by the extension of the url
+func stableURL(groupID string, object *Object) string {
+	return linksPath + "/" + url.PathEscape(groupID) + "/" + url.PathEscape(object.ID) + "/" + url.PathEscape(object.Filename)
+}
+
+//linkExpiry Reads the expiry of S3 presigned links
+//Signature version 4 links contain the signing time and lifetime, version 2 links the expiry as unix time
+func linkExpiry(rawURL string) (time.Time, bool) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return time.Time{}, false
+	}
+	query := parsedURL.Query()
+
+	if date, lifetime := query.Get("X-Amz-Date"), query.Get("X-Amz-Expires"); date != "" && lifetime != "" {
+		signed, err := time.Parse("20060102T150405Z", date)
+		if err != nil {
+			return time.Time{}, false
+		}
+
+		seconds, err := strconv.Atoi(lifetime)
+		if err != nil {
+			return time.Time{}, false
+		}
+
+		return signed.Add(time.Duration(seconds) * time.Second), true
+	}
+
+	if expires := query.Get("Expires"); expires != "" {
+		seconds, err := strconv.ParseInt(expires, 10, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+
+		return time.Unix(seconds, 0), true
+	}
+
+	return time.Time{}, false
+}
+
+//LinkEndpoints Serves the stable track urls
+type LinkEndpoints struct {
+	Links       *LinkProxy
+	DataHandler DataHandler
+	AutHandler  AuthHandler
+	Access      *AccessPolicy
+}
+
+//ObjectLinkID Object of an object group in a stable url
+type ObjectLinkID struct {
+	GroupID  string `uri:"group" binding:"required"`
+	ObjectID string `uri:"object" binding:"required"`
+}
+
+//GetObject Redirects to a presigned link of an object or streams the object, expired links are signed again
+func (endpoints *LinkEndpoints) GetObject(c *gin.Context) {
+	var id ObjectLinkID
+	err := c.BindUri(&id)
+	if err != nil {
+		abortWithDataError(c, &InvalidRequestError{Err: err})
+		return
+	}
+
+	credentials, err := endpoints.AutHandler.CredentialsFromGinContext(c)
+	if err != nil {
+		abortWithDataError(c, err)
+		return
+	}
+
+	link, ok := endpoints.Links.signed(credentials, id.GroupID, id.ObjectID)
+	if !ok {
+		//Requesting the object group stores new links for all of its objects
+		_, err := endpoints.DataHandler.getObjectGroup(c.Request.Context(), id.GroupID, credentials)
+		if err != nil {
+			abortWithDataError(c, err)
+			return
+		}
+
+		link, ok = endpoints.Links.signed(credentials, id.GroupID, id.ObjectID)
+		if !ok {
+			abortWithDataError(c, &NotFoundError{Resource: "object", ID: id.ObjectID})
+			return
+		}
+	}
+
+	//The permissions are checked for every request, the links could have been handed out before a change of the access rules
+	datasetID, _ := endpoints.Links.datasetOf(id.GroupID)
+	trackType, ok := endpoints.DataHandler.trackTypeOfDataset(datasetID)
+	if !ok {
+		abortWithDataError(c, &NotFoundError{Resource: "object group", ID: id.GroupID})
+		return
+	}
+
+	if !endpoints.Access.PermissionsFor(UserFromGinContext(c)).AllowsObjectGroup(trackType, id.GroupID) {
+		abortWithDataError(c, &ForbiddenError{TrackType: trackType, ObjectGroupID: id.GroupID})
+		return
+	}
+
+	//The redirect must not be cached longer than the link is valid
+	c.Header("Cache-Control", "no-store")
+
+	if !endpoints.Links.Stream {
+		c.Redirect(http.StatusTemporaryRedirect, link)
+		return
+	}
+
+	endpoints.stream(c, link)
+}
+
+//stream Copies the object from the presigned link to the response, range requests are passed on
+func (endpoints *LinkEndpoints) stream(c *gin.Context, link string) {
+	request, err := http.NewRequestWithContext(c.Request.Context(), c.Request.Method, link, nil)
+	if err != nil {
+		abortWithDataError(c, err)
+		return
+	}
+
+	for _, header := range streamedHeaders {
+		if value := c.GetHeader(header); value != "" {
+			request.Header.Set(header, value)
+		}
+	}
+
+	response, err := endpoints.Links.Client.Do(request)
+	if err != nil {
+		abortWithErrorResponse(c, 502, "backend_error", err)
+		return
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 400 {
+		err := fmt.Errorf("storage responded with status %v for a streamed object", response.StatusCode)
+		abortWithErrorResponse(c, 502, "backend_error", err)
+		return
+	}
+
+	for _, header := range streamedResponseHeaders {
+		if value := response.Header.Get(header); value != "" {
+			c.Header(header, value)
+		}
+	}
+
+	c.Status(response.StatusCode)
+	_, err = io.Copy(c.Writer, response.Body)
+	if err != nil {
+		log.Println(err.Error())
+	}
+}
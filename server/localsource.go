@@ -0,0 +1,255 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+//LocalSource TrackSource that serves datasets from a local directory
+//Every dataset is a subdirectory of Root named after its dataset id,
+//every subdirectory of a dataset is treated as an object group.
+//Datasets on disk are not versioned, the dataset id is used as the id of the only version.
+//Attributes of the object groups are read from a metadata.tsv or metadata.json file in the dataset directory.
+type LocalSource struct {
+	Root string
+}
+
+//GetCurrentDatasetVersion Returns the version of a local dataset
+func (source *LocalSource) GetCurrentDatasetVersion(ctx context.Context, datasetID string, credentials Credentials) (*DatasetVersion, error) {
+	datasetPath, err := source.resolve(datasetID)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	info, err := os.Stat(datasetPath)
+	if os.IsNotExist(err) {
+		err := &NotFoundError{Resource: "dataset", ID: datasetID}
+		log.Println(err.Error())
+		return nil, err
+	}
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		err := &InvalidDatasetError{DatasetID: datasetID, Reason: "not a directory"}
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	return &DatasetVersion{
+		ID:        datasetID,
+		DatasetID: datasetID,
+	}, nil
+}
+
+//GetDatasetObjectGroups Returns all object groups of a local dataset
+func (source *LocalSource) GetDatasetObjectGroups(ctx context.Context, datasetVersion *DatasetVersion, credentials Credentials) ([]*ObjectGroup, error) {
+	return source.readDataset(datasetVersion, false)
+}
+
+//GetDatasetDownloadLinks Returns all object groups of a local dataset with links to the files
+func (source *LocalSource) GetDatasetDownloadLinks(ctx context.Context, datasetVersion *DatasetVersion, credentials Credentials) ([]*ObjectGroup, error) {
+	return source.readDataset(datasetVersion, true)
+}
+
+//GetObjectGroup Returns a local object group with links to its files
+func (source *LocalSource) GetObjectGroup(ctx context.Context, groupID string, credentials Credentials) (*ObjectGroup, error) {
+	relativePath, err := decodeLocalID(groupID)
+	if err != nil {
+		err := &NotFoundError{Resource: "object group", ID: groupID}
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	return source.readObjectGroup(relativePath, true)
+}
+
+//ReadObjectHeader Returns up to size bytes from the start of a local file
+func (source *LocalSource) ReadObjectHeader(object *Object, size int) ([]byte, error) {
+	relativePath, err := decodeLocalID(object.ID)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	objectPath, err := source.resolve(relativePath)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	file, err := os.Open(objectPath)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	defer file.Close()
+
+	header := make([]byte, size)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	return header[:n], nil
+}
+
+func (source *LocalSource) readDataset(datasetVersion *DatasetVersion, withLinks bool) ([]*ObjectGroup, error) {
+	datasetPath, err := source.resolve(datasetVersion.DatasetID)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	entries, err := ioutil.ReadDir(datasetPath)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	var groups []*ObjectGroup
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		group, err := source.readObjectGroup(path.Join(datasetVersion.DatasetID, entry.Name()), withLinks)
+		if err != nil {
+			log.Println(err.Error())
+			return nil, err
+		}
+
+		groups = append(groups, group)
+	}
+
+	return groups, nil
+}
+
+//readObjectGroup Reads the files of a group directory, relativePath is relative to Root and slash separated
+func (source *LocalSource) readObjectGroup(relativePath string, withLinks bool) (*ObjectGroup, error) {
+	groupPath, err := source.resolve(relativePath)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	entries, err := ioutil.ReadDir(groupPath)
+	if os.IsNotExist(err) {
+		err := &NotFoundError{Resource: "object group", ID: encodeLocalID(relativePath)}
+		log.Println(err.Error())
+		return nil, err
+	}
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	datasetID := strings.SplitN(relativePath, "/", 2)[0]
+	datasetPath, err := source.resolve(datasetID)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	metadata, err := readLocalMetadata(datasetPath)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	group := ObjectGroup{
+		ID:         encodeLocalID(relativePath),
+		Name:       path.Base(relativePath),
+		DatasetID:  datasetID,
+		Objects:    make([]*Object, 0),
+		Attributes: metadata[path.Base(relativePath)],
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		objectPath := path.Join(relativePath, entry.Name())
+		object := Object{
+			ID:       encodeLocalID(objectPath),
+			Filename: entry.Name(),
+		}
+
+		if withLinks {
+			object.URL = source.fileURL(objectPath)
+		}
+
+		group.Objects = append(group.Objects, &object)
+	}
+
+	return &group, nil
+}
+
+//fileURL Returns the url under which the file is served by the FileEndpoints
+func (source *LocalSource) fileURL(relativePath string) string {
+	fileURL := url.URL{
+		Path: path.Join(localFilesPath, relativePath),
+	}
+
+	return fileURL.EscapedPath()
+}
+
+//resolve Returns the filesystem path for a slash separated path relative to Root
+//Paths that would leave Root are rejected, also if they leave it through a symlink below Root
+func (source *LocalSource) resolve(relativePath string) (string, error) {
+	cleanedPath := path.Clean("/" + relativePath)
+	if cleanedPath == "/" || strings.Contains(relativePath, "\\") {
+		return "", fmt.Errorf("invalid local path: %v", relativePath)
+	}
+
+	filePath := filepath.Join(source.Root, filepath.FromSlash(cleanedPath))
+
+	//Missing files are reported by the caller
+	resolvedPath, err := filepath.EvalSymlinks(filePath)
+	if os.IsNotExist(err) {
+		return filePath, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	root, err := filepath.EvalSymlinks(source.Root)
+	if err != nil {
+		return "", err
+	}
+
+	relativeToRoot, err := filepath.Rel(root, resolvedPath)
+	if err != nil || relativeToRoot == ".." || strings.HasPrefix(relativeToRoot, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("local path %v points outside of the root", relativePath)
+	}
+
+	return filePath, nil
+}
+
+//encodeLocalID Creates an url safe id from a path relative to Root
+func encodeLocalID(relativePath string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(relativePath))
+}
+
+func decodeLocalID(id string) (string, error) {
+	relativePath, err := base64.RawURLEncoding.DecodeString(id)
+	if err != nil {
+		return "", fmt.Errorf("invalid local id: %v", id)
+	}
+
+	return string(relativePath), nil
+}
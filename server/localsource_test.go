@@ -0,0 +1,242 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+//testdataRoot Fixture datasets in the repository root, also used as Backend.Local.Root in the README
+const testdataRoot = "../testdata"
+
+func newTestDataHandler(t *testing.T) (*DataHandler, *Genome) {
+	t.Helper()
+
+	strands, err := NewStrandPatternsFromConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	genome := &Genome{
+		ID:   "NC_002942",
+		Name: "NC_002942",
+		Datasets: GenomeDatasets{
+			Reference:     "reference",
+			GFFAnnotation: "annotation",
+			Bam:           "alignments",
+			Bigwigs:       "bigwigs",
+		},
+	}
+
+	return &DataHandler{
+		Source:  &LocalSource{Root: testdataRoot},
+		Genomes: []*Genome{genome},
+		Strands: strands,
+	}, genome
+}
+
+func TestLocalSourceGetCurrentDatasetVersion(t *testing.T) {
+	source := &LocalSource{Root: testdataRoot}
+
+	tests := []struct {
+		name      string
+		datasetID string
+		wantErr   interface{}
+	}{
+		{name: "dataset directory", datasetID: "bigwigs"},
+		{name: "missing dataset", datasetID: "missing", wantErr: &NotFoundError{}},
+		{name: "file instead of directory", datasetID: "bigwigs/metadata.tsv", wantErr: &InvalidDatasetError{}},
+		{name: "path outside of the root", datasetID: "../server", wantErr: &NotFoundError{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			datasetVersion, err := source.GetCurrentDatasetVersion(context.Background(), test.datasetID, Credentials{})
+
+			switch wantErr := test.wantErr.(type) {
+			case nil:
+				if err != nil {
+					t.Fatal(err)
+				}
+				if datasetVersion.ID != test.datasetID || datasetVersion.DatasetID != test.datasetID {
+					t.Errorf("got version %+v", datasetVersion)
+				}
+			case *NotFoundError:
+				if !errors.As(err, &wantErr) {
+					t.Errorf("got error %v, want a NotFoundError", err)
+				}
+			case *InvalidDatasetError:
+				if !errors.As(err, &wantErr) {
+					t.Errorf("got error %v, want an InvalidDatasetError", err)
+				}
+			}
+		})
+	}
+}
+
+func TestLocalSourceObjectGroups(t *testing.T) {
+	source := &LocalSource{Root: testdataRoot}
+	datasetVersion := &DatasetVersion{ID: "bigwigs", DatasetID: "bigwigs"}
+
+	groups, err := source.GetDatasetDownloadLinks(context.Background(), datasetVersion, Credentials{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 {
+		t.Fatalf("got %v object groups, want 1", len(groups))
+	}
+
+	group := groups[0]
+	if group.Name != "WT_37C_1" || group.DatasetID != "bigwigs" || len(group.Objects) != 2 {
+		t.Errorf("got object group %+v", group)
+	}
+	if group.Attributes["condition"] != "WT" || group.Attributes["replicate"] != "1" {
+		t.Errorf("got attributes %v from metadata.tsv", group.Attributes)
+	}
+	if url := group.Objects[0].URL; url != "/files/bigwigs/WT_37C_1/WT_37C_1_fwd.bw" {
+		t.Errorf("got url %v", url)
+	}
+
+	single, err := source.GetObjectGroup(context.Background(), group.ID, Credentials{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if single.ID != group.ID || len(single.Objects) != 2 {
+		t.Errorf("got object group %+v", single)
+	}
+
+	_, err = source.GetObjectGroup(context.Background(), encodeLocalID("bigwigs/missing"), Credentials{})
+	var notFound *NotFoundError
+	if !errors.As(err, &notFound) {
+		t.Errorf("got error %v for a missing group, want a NotFoundError", err)
+	}
+}
+
+func TestLocalSourceReadObjectHeader(t *testing.T) {
+	handler, _ := newTestDataHandler(t)
+	group, err := handler.Source.GetObjectGroup(context.Background(), encodeLocalID("alignments/WT_37C_1"), Credentials{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	classified := handler.classifyObjectGroup(group)
+	if len(classified.Data) != 1 || classified.Data[0].Format != FormatBAM || classified.Data[0].Compression != CompressionNone {
+		t.Fatalf("got data files %+v", classified.Data)
+	}
+	if len(classified.Indexes) != 1 || classified.Indexes[0].Format != FormatBAI {
+		t.Fatalf("got indexes %+v", classified.Indexes)
+	}
+}
+
+func TestDataHandlerWithLocalSource(t *testing.T) {
+	handler, genome := newTestDataHandler(t)
+	ctx := context.Background()
+	permissions := AllowAllPermissions()
+
+	fasta, fastaIndex, err := handler.GetReferenceFasta(ctx, genome, Credentials{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fasta.URL != "/files/reference/NC_002942/NC_002942.fasta" || fastaIndex.URL != "/files/reference/NC_002942/NC_002942.fasta.fai" {
+		t.Errorf("got fasta %v with index %v", fasta.URL, fastaIndex.URL)
+	}
+
+	bamList, err := handler.GetBamList(ctx, genome, Credentials{}, permissions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bamList["ALL"]) != 1 || bamList["ALL"][0].GroupName != "WT_37C_1.bam" {
+		t.Fatalf("got bam list %+v", bamList)
+	}
+
+	bamTracks, err := handler.GetBamTrack(ctx, genome, bamList["ALL"][0].GroupID, Credentials{}, permissions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bamTracks) != 1 || bamTracks[0].Type != "alignment" || bamTracks[0].IndexURL != "/files/alignments/WT_37C_1/WT_37C_1.bam.bai" {
+		t.Errorf("got bam tracks %+v", bamTracks)
+	}
+
+	bigWigsList, err := handler.GetBigWigsList(ctx, genome, Credentials{}, permissions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bigWigsList["ALL"]) != 1 || bigWigsList["ALL"][0].GroupName != "WT_37C_1" {
+		t.Fatalf("got bigwigs list %+v", bigWigsList)
+	}
+
+	bigWigsTracks, err := handler.GetBigWigsTrack(ctx, genome, bigWigsList["ALL"][0].GroupID, Credentials{}, permissions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bigWigsTracks) != 1 || bigWigsTracks[0].Type != "merged" || len(bigWigsTracks[0].Tracks) != 2 {
+		t.Fatalf("got bigwigs tracks %+v", bigWigsTracks)
+	}
+	if forward, reverse := bigWigsTracks[0].Tracks[0], bigWigsTracks[0].Tracks[1]; forward.Mirror || !reverse.Mirror {
+		t.Errorf("got mirror %v for the forward and %v for the reverse strand, want only the reverse strand mirrored", forward.Mirror, reverse.Mirror)
+	}
+	if bigWigsTracks[0].Attributes["growth_phase"] != "exponential" {
+		t.Errorf("got attributes %v", bigWigsTracks[0].Attributes)
+	}
+
+	//An object group of another dataset must not be loaded as a track of this dataset
+	_, err = handler.GetBamTrack(ctx, genome, bigWigsList["ALL"][0].GroupID, Credentials{}, permissions)
+	var forbidden *ForbiddenError
+	if !errors.As(err, &forbidden) {
+		t.Errorf("got error %v for a group of another dataset, want a ForbiddenError", err)
+	}
+}
+
+//TestDataHandlerCramTrackNeedsReference The browser decodes CRAM reads with the reference, so the track is only returned if the FASTA may be read
+func TestDataHandlerCramTrackNeedsReference(t *testing.T) {
+	root, err := ioutil.TempDir("", "cram")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	groupDir := filepath.Join(root, "cram", "sample")
+	err = os.MkdirAll(groupDir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(groupDir, "sample.cram"), []byte("CRAM\x03\x00"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(groupDir, "sample.cram.crai"), nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	genome := &Genome{ID: "NC_002942", Datasets: GenomeDatasets{Cram: "cram"}}
+	handler := &DataHandler{Source: &LocalSource{Root: root}, Genomes: []*Genome{genome}}
+	ctx := context.Background()
+
+	cramList, err := handler.GetCramList(ctx, genome, Credentials{}, AllowAllPermissions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cramList["ALL"]) != 1 {
+		t.Fatalf("got cram list %+v", cramList)
+	}
+	groupID := cramList["ALL"][0].GroupID
+
+	//The reference is not read by the track request, only the permission to read it is checked
+	_, err = handler.GetCramTrack(ctx, genome, groupID, Credentials{}, &Permissions{datasets: map[TrackType]bool{CRAM: true}})
+	var forbidden *ForbiddenError
+	if !errors.As(err, &forbidden) || forbidden.TrackType != FastaRef {
+		t.Errorf("got error %v without access to the reference, want a ForbiddenError for %v", err, FastaRef)
+	}
+
+	cramTracks, err := handler.GetCramTrack(ctx, genome, groupID, Credentials{}, &Permissions{datasets: map[TrackType]bool{CRAM: true, FastaRef: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cramTracks) != 1 || cramTracks[0].Format != "cram" || cramTracks[0].IndexURL != "/files/cram/sample/sample.cram.crai" {
+		t.Errorf("got cram tracks %+v", cramTracks)
+	}
+}
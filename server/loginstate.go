@@ -0,0 +1,135 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+//loginStateCookie Name of the cookie that stores the state of a running login
+const loginStateCookie = "loginstate"
+
+//loginStateLifetime Time a user has to complete the login at the identity provider
+const loginStateLifetime = 10 * time.Minute
+
+var (
+	errLoginStateMissing  = errors.New("login state cookie not found")
+	errLoginStateInvalid  = errors.New("login state cookie has an invalid signature")
+	errLoginStateExpired  = errors.New("login state has expired")
+	errLoginStateMismatch = errors.New("login state does not match the state of the callback")
+)
+
+//loginState State of a single login attempt, kept in a signed cookie between /login and the callback
+type loginState struct {
+	State        string    `json:"state"`
+	CodeVerifier string    `json:"verifier"`
+	Expires      time.Time `json:"expires"`
+}
+
+//newLoginState Creates a login state with a random oauth2 state and PKCE code verifier
+func newLoginState() (*loginState, error) {
+	state, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+
+	verifier, err := randomString(64)
+	if err != nil {
+		return nil, err
+	}
+
+	return &loginState{
+		State:        state,
+		CodeVerifier: verifier,
+		Expires:      time.Now().Add(loginStateLifetime),
+	}, nil
+}
+
+//codeChallenge Returns the S256 PKCE code challenge of the code verifier
+func (state *loginState) codeChallenge() string {
+	hash := sha256.Sum256([]byte(state.CodeVerifier))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+//setLoginStateCookie Stores the login state in a signed, short-lived cookie
+func (handler *AuthHandler) setLoginStateCookie(c *gin.Context, state *loginState) error {
+	rawState, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(rawState)
+	value := payload + "." + handler.sign(payload)
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(loginStateCookie, value, int(loginStateLifetime.Seconds()), "/auth", "", true, true)
+
+	return nil
+}
+
+//popLoginState Reads and removes the login state cookie and checks it against the state of the callback
+func (handler *AuthHandler) popLoginState(c *gin.Context, callbackState string) (*loginState, error) {
+	value, err := c.Cookie(loginStateCookie)
+	if err != nil {
+		return nil, errLoginStateMissing
+	}
+
+	//A login state can only be used once
+	c.SetCookie(loginStateCookie, "", -1, "/auth", "", true, true)
+
+	parts := strings.Split(value, ".")
+	if len(parts) != 2 {
+		return nil, errLoginStateInvalid
+	}
+
+	if !hmac.Equal([]byte(parts[1]), []byte(handler.sign(parts[0]))) {
+		return nil, errLoginStateInvalid
+	}
+
+	rawState, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errLoginStateInvalid
+	}
+
+	var state loginState
+	err = json.Unmarshal(rawState, &state)
+	if err != nil {
+		return nil, errLoginStateInvalid
+	}
+
+	if time.Now().After(state.Expires) {
+		return nil, errLoginStateExpired
+	}
+
+	if subtle.ConstantTimeCompare([]byte(state.State), []byte(callbackState)) != 1 {
+		return nil, errLoginStateMismatch
+	}
+
+	return &state, nil
+}
+
+func (handler *AuthHandler) sign(payload string) string {
+	mac := hmac.New(sha256.New, handler.CookieSecret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+//randomString Returns a url safe string of n random bytes
+func randomString(n int) (string, error) {
+	randomBytes := make([]byte, n)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(randomBytes), nil
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	_struct "github.com/golang/protobuf/ptypes/struct"
+)
+
+const (
+	//localMetadataTSV Sidecar file in a local dataset directory, the first column is the object group directory name
+	localMetadataTSV = "metadata.tsv"
+	//localMetadataJSON Sidecar file in a local dataset directory, maps the object group directory names to their attributes
+	localMetadataJSON = "metadata.json"
+	//otherGroupName Dropdown group of object groups without the attribute that is used for grouping
+	otherGroupName = "Other"
+)
+
+//attributesFromStruct Converts the top level scalar fields of BioDataDB additional metadata to attributes
+func attributesFromStruct(metadata *_struct.Struct, attributes map[string]string) map[string]string {
+	for key, value := range metadata.GetFields() {
+		if _, ok := attributes[key]; ok {
+			continue
+		}
+
+		var attribute string
+		switch kind := value.GetKind().(type) {
+		case *_struct.Value_StringValue:
+			attribute = kind.StringValue
+		case *_struct.Value_NumberValue:
+			attribute = strconv.FormatFloat(kind.NumberValue, 'f', -1, 64)
+		case *_struct.Value_BoolValue:
+			attribute = strconv.FormatBool(kind.BoolValue)
+		default:
+			continue
+		}
+
+		if attributes == nil {
+			attributes = make(map[string]string)
+		}
+		attributes[key] = attribute
+	}
+
+	return attributes
+}
+
+//readLocalMetadata Reads the attributes of the object groups of a local dataset from its sidecar file
+//Returns no attributes if the dataset has no sidecar file
+func readLocalMetadata(datasetPath string) (map[string]map[string]string, error) {
+	metadata, err := readMetadataTSV(filepath.Join(datasetPath, localMetadataTSV))
+	if err == nil || !os.IsNotExist(err) {
+		return metadata, err
+	}
+
+	metadata, err = readMetadataJSON(filepath.Join(datasetPath, localMetadataJSON))
+	if err != nil && os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	return metadata, err
+}
+
+func readMetadataTSV(metadataPath string) (map[string]map[string]string, error) {
+	file, err := os.Open(metadataPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comma = '\t'
+	reader.Comment = '#'
+
+	header, err := reader.Read()
+	if err != nil {
+		err := fmt.Errorf("could not read header of %v: %v", metadataPath, err.Error())
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	metadata := make(map[string]map[string]string)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Println(err.Error())
+			return nil, err
+		}
+
+		attributes := make(map[string]string)
+		for i, value := range record[1:] {
+			if value != "" {
+				attributes[header[i+1]] = value
+			}
+		}
+		metadata[record[0]] = attributes
+	}
+
+	return metadata, nil
+}
+
+func readMetadataJSON(metadataPath string) (map[string]map[string]string, error) {
+	file, err := os.Open(metadataPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	metadata := make(map[string]map[string]string)
+	err = json.NewDecoder(file).Decode(&metadata)
+	if err != nil {
+		err := fmt.Errorf("could not parse %v: %v", metadataPath, err.Error())
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	return metadata, nil
+}
+
+//groupFileGroups Subdivides the file groups by the value of an attribute
+//Without an attribute all file groups are returned under the ALL key
+func groupFileGroups(fileGroups []FileGroup, groupBy string) map[string][]FileGroup {
+	groupedFiles := make(map[string][]FileGroup)
+
+	for _, fileGroup := range fileGroups {
+		key := "ALL"
+		if groupBy != "" {
+			key = otherGroupName
+			if value := fileGroup.Attributes[groupBy]; value != "" {
+				key = value
+			}
+		}
+
+		groupedFiles[key] = append(groupedFiles[key], fileGroup)
+	}
+
+	return groupedFiles
+}
+
+//withAttributes Adds the attributes of an object group to its tracks, igv.js keeps them in the track config
+//The name and color attributes of a sample sheet replace the track name and color, merged tracks keep their strand colors
+func withAttributes(tracks []Track, attributes map[string]string) []Track {
+	for i := range tracks {
+		tracks[i].Attributes = attributes
+
+		if name := attributes[sampleNameColumn]; name != "" {
+			if len(tracks) == 1 {
+				tracks[i].Name = name
+			} else {
+				tracks[i].Name = fmt.Sprintf("%v (%v)", name, tracks[i].Name)
+			}
+		}
+
+		if color := attributes[sampleColorColumn]; color != "" && tracks[i].Type != "merged" {
+			tracks[i].Color = color
+		}
+	}
+
+	return tracks
+}
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/coreos/go-oidc"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+)
+
+//userContextKey Key of the logged in user in the gin context
+const userContextKey = "user"
+
+var errNoIDToken = errors.New("token response does not contain an id token")
+
+//UserInfo Identity of the logged in user, taken from the verified id token
+type UserInfo struct {
+	Subject           string   `json:"sub"`
+	Name              string   `json:"name"`
+	PreferredUsername string   `json:"preferred_username"`
+	Email             string   `json:"email"`
+	Groups            []string `json:"groups,omitempty"`
+	Roles             []string `json:"roles,omitempty"`
+}
+
+//roleClaims Role claims as issued by Keycloak, realm roles and roles of the client are used
+type roleClaims struct {
+	RealmAccess struct {
+		Roles []string `json:"roles"`
+	} `json:"realm_access"`
+	ResourceAccess map[string]struct {
+		Roles []string `json:"roles"`
+	} `json:"resource_access"`
+}
+
+//DisplayName Returns the best available name of the user
+func (user *UserInfo) DisplayName() string {
+	switch {
+	case user.Name != "":
+		return user.Name
+	case user.PreferredUsername != "":
+		return user.PreferredUsername
+	case user.Email != "":
+		return user.Email
+	default:
+		return user.Subject
+	}
+}
+
+//OIDCVerifier Verifies OpenID Connect id tokens against the JWKS of the issuer
+//The discovery document of the issuer is loaded on first use, so the server can start while the issuer is unavailable
+type OIDCVerifier struct {
+	IssuerURL   string
+	ClientID    string
+	UserInfoURL string
+
+	mutex    sync.Mutex
+	verifier *oidc.IDTokenVerifier
+}
+
+//VerifyToken Verifies the signature, issuer, audience and expiry of the id token in a token response
+//Name and email are completed from the userinfo endpoint if the id token does not contain them
+func (verifier *OIDCVerifier) VerifyToken(ctx context.Context, oauth2Conf *oauth2.Config, token *oauth2.Token) (*UserInfo, error) {
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, errNoIDToken
+	}
+
+	idTokenVerifier, err := verifier.idTokenVerifier()
+	if err != nil {
+		return nil, err
+	}
+
+	idToken, err := idTokenVerifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, err
+	}
+
+	var user UserInfo
+	err = idToken.Claims(&user)
+	if err != nil {
+		return nil, err
+	}
+
+	var roles roleClaims
+	err = idToken.Claims(&roles)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Roles = append(user.Roles, roles.RealmAccess.Roles...)
+	user.Roles = append(user.Roles, roles.ResourceAccess[verifier.ClientID].Roles...)
+
+	if (user.Name == "" || user.Email == "") && verifier.UserInfoURL != "" {
+		err = verifier.completeFromUserInfo(ctx, oauth2Conf, token, &user)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+func (verifier *OIDCVerifier) idTokenVerifier() (*oidc.IDTokenVerifier, error) {
+	verifier.mutex.Lock()
+	defer verifier.mutex.Unlock()
+
+	if verifier.verifier != nil {
+		return verifier.verifier, nil
+	}
+
+	//The context is kept by the provider to refresh the keys of the issuer
+	provider, err := oidc.NewProvider(context.Background(), verifier.IssuerURL)
+	if err != nil {
+		return nil, err
+	}
+
+	verifier.verifier = provider.Verifier(&oidc.Config{ClientID: verifier.ClientID})
+
+	return verifier.verifier, nil
+}
+
+func (verifier *OIDCVerifier) completeFromUserInfo(ctx context.Context, oauth2Conf *oauth2.Config, token *oauth2.Token, user *UserInfo) error {
+	response, err := oauth2Conf.Client(ctx, token).Get(verifier.UserInfoURL)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		return fmt.Errorf("userinfo request failed with status: %v", response.Status)
+	}
+
+	var userInfo UserInfo
+	err = json.NewDecoder(response.Body).Decode(&userInfo)
+	if err != nil {
+		return err
+	}
+
+	//The userinfo has to describe the same user as the id token
+	if userInfo.Subject != user.Subject {
+		return fmt.Errorf("subject of userinfo does not match the id token")
+	}
+
+	if user.Name == "" {
+		user.Name = userInfo.Name
+	}
+	if user.Email == "" {
+		user.Email = userInfo.Email
+	}
+	if user.PreferredUsername == "" {
+		user.PreferredUsername = userInfo.PreferredUsername
+	}
+
+	return nil
+}
+
+//UserFromGinContext Returns the logged in user of a request, nil if there is none
+func UserFromGinContext(c *gin.Context) *UserInfo {
+	user, ok := c.Get(userContextKey)
+	if !ok {
+		return nil
+	}
+
+	return user.(*UserInfo)
+}
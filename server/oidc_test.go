@@ -0,0 +1,237 @@
+package server
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const testClientID = "dashboard"
+
+//testIssuer OpenID Connect issuer that serves the discovery document, the JWKS and the userinfo of a single user
+type testIssuer struct {
+	*httptest.Server
+	Key      *rsa.PrivateKey
+	UserInfo map[string]interface{}
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issuer := &testIssuer{Key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                issuer.URL,
+			"authorization_endpoint":                issuer.URL + "/auth",
+			"token_endpoint":                        issuer.URL + "/token",
+			"userinfo_endpoint":                     issuer.URL + "/userinfo",
+			"jwks_uri":                              issuer.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"kid": "test",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access" {
+			w.WriteHeader(401)
+			return
+		}
+		json.NewEncoder(w).Encode(issuer.UserInfo)
+	})
+
+	issuer.Server = httptest.NewServer(mux)
+
+	return issuer
+}
+
+//sign Creates an RS256 signed id token with the given claims
+func (issuer *testIssuer) sign(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	t.Helper()
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestOIDCVerifierVerifyToken(t *testing.T) {
+	issuer := newTestIssuer(t)
+	defer issuer.Close()
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := func(changes map[string]interface{}) map[string]interface{} {
+		claims := map[string]interface{}{
+			"iss":                issuer.URL,
+			"sub":                "user-1",
+			"aud":                testClientID,
+			"exp":                time.Now().Add(time.Hour).Unix(),
+			"iat":                time.Now().Unix(),
+			"name":               "Jane Doe",
+			"preferred_username": "jdoe",
+			"email":              "jane@example.org",
+			"realm_access":       map[string]interface{}{"roles": []string{"user"}},
+			"resource_access": map[string]interface{}{
+				testClientID: map[string]interface{}{"roles": []string{"admin"}},
+				"other":      map[string]interface{}{"roles": []string{"ignored"}},
+			},
+		}
+		for claim, value := range changes {
+			if value == nil {
+				delete(claims, claim)
+				continue
+			}
+			claims[claim] = value
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name        string
+		key         *rsa.PrivateKey
+		claims      map[string]interface{}
+		userInfoURL string
+		userInfo    map[string]interface{}
+		want        *UserInfo
+		wantErr     bool
+	}{
+		{
+			name:   "valid token",
+			key:    issuer.Key,
+			claims: claims(nil),
+			want: &UserInfo{
+				Subject:           "user-1",
+				Name:              "Jane Doe",
+				PreferredUsername: "jdoe",
+				Email:             "jane@example.org",
+				Roles:             []string{"user", "admin"},
+			},
+		},
+		{
+			name:    "bad signature",
+			key:     otherKey,
+			claims:  claims(nil),
+			wantErr: true,
+		},
+		{
+			name:    "wrong audience",
+			key:     issuer.Key,
+			claims:  claims(map[string]interface{}{"aud": "other-client"}),
+			wantErr: true,
+		},
+		{
+			name:    "expired token",
+			key:     issuer.Key,
+			claims:  claims(map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()}),
+			wantErr: true,
+		},
+		{
+			name:        "missing claims from userinfo",
+			key:         issuer.Key,
+			claims:      claims(map[string]interface{}{"name": nil, "email": nil}),
+			userInfoURL: issuer.URL + "/userinfo",
+			userInfo:    map[string]interface{}{"sub": "user-1", "name": "Jane Doe", "email": "jane@example.org"},
+			want: &UserInfo{
+				Subject:           "user-1",
+				Name:              "Jane Doe",
+				PreferredUsername: "jdoe",
+				Email:             "jane@example.org",
+				Roles:             []string{"user", "admin"},
+			},
+		},
+		{
+			name:        "userinfo of another user",
+			key:         issuer.Key,
+			claims:      claims(map[string]interface{}{"name": nil, "email": nil}),
+			userInfoURL: issuer.URL + "/userinfo",
+			userInfo:    map[string]interface{}{"sub": "user-2", "name": "John Doe", "email": "john@example.org"},
+			wantErr:     true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			issuer.UserInfo = test.userInfo
+
+			verifier := &OIDCVerifier{
+				IssuerURL:   issuer.URL,
+				ClientID:    testClientID,
+				UserInfoURL: test.userInfoURL,
+			}
+			oauth2Conf := &oauth2.Config{ClientID: testClientID}
+			token := (&oauth2.Token{AccessToken: "access", TokenType: "Bearer"}).WithExtra(map[string]interface{}{
+				"id_token": issuer.sign(t, test.key, test.claims),
+			})
+
+			user, err := verifier.VerifyToken(context.Background(), oauth2Conf, token)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("got user %+v, want an error", user)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(user, test.want) {
+				t.Errorf("got user %+v, want %+v", user, test.want)
+			}
+		})
+	}
+}
+
+func TestOIDCVerifierMissingIDToken(t *testing.T) {
+	verifier := &OIDCVerifier{ClientID: testClientID}
+
+	_, err := verifier.VerifyToken(context.Background(), &oauth2.Config{}, &oauth2.Token{AccessToken: "access"})
+	if err != errNoIDToken {
+		t.Errorf("got error %v, want %v", err, errNoIDToken)
+	}
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+//datasetCall A backend call for the dataset of a track type that can run concurrently to other calls
+type datasetCall struct {
+	TrackType TrackType
+	Call      func(ctx context.Context) error
+}
+
+//DatasetCallError Names the dataset of a failed backend call
+type DatasetCallError struct {
+	TrackType TrackType
+	DatasetID string
+	Err       error
+}
+
+func (err *DatasetCallError) Error() string {
+	return fmt.Sprintf("%v dataset with id: %v: %v", err.TrackType, err.DatasetID, err.Err.Error())
+}
+
+//Unwrap Returns the error of the backend call
+func (err *DatasetCallError) Unwrap() error {
+	return err.Err
+}
+
+//DatasetCallErrors All failed calls of a group of concurrent backend calls
+type DatasetCallErrors []*DatasetCallError
+
+func (errs DatasetCallErrors) Error() string {
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+//Unwrap Returns the first failed call, its error decides the status of the response
+func (errs DatasetCallErrors) Unwrap() error {
+	return errs[0]
+}
+
+//runDatasetCalls Runs the calls concurrently, every call gets its own deadline of CallTimeout
+//The first failed call cancels the others, the errors of all failed calls are returned
+func (datahandler *DataHandler) runDatasetCalls(ctx context.Context, genome *Genome, calls ...datasetCall) error {
+	group, groupCtx := errgroup.WithContext(ctx)
+
+	var mutex sync.Mutex
+	var errs DatasetCallErrors
+
+	for _, call := range calls {
+		call := call
+		group.Go(func() error {
+			callCtx := groupCtx
+			if datahandler.CallTimeout > 0 {
+				var cancel context.CancelFunc
+				callCtx, cancel = context.WithTimeout(groupCtx, datahandler.CallTimeout)
+				defer cancel()
+			}
+
+			err := call.Call(callCtx)
+			if err == nil {
+				return nil
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			//Calls that were cancelled because another call failed are not reported
+			if len(errs) > 0 && isCancellation(err) {
+				return err
+			}
+
+			errs = append(errs, &DatasetCallError{
+				TrackType: call.TrackType,
+				DatasetID: genome.datasetID(call.TrackType),
+				Err:       err,
+			})
+			return err
+		})
+	}
+
+	if group.Wait() != nil {
+		return errs
+	}
+
+	return nil
+}
+
+//isCancellation Returns true if a call failed because its context was cancelled
+func isCancellation(err error) bool {
+	return errors.Is(err, context.Canceled) || status.Code(err) == codes.Canceled
+}
@@ -0,0 +1,511 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/ag-computational-bio/BioDataDBModels/go/client"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+const (
+	//sampleSheetMaxSize Maximum size of an uploaded sample sheet
+	sampleSheetMaxSize = 10 << 20
+
+	sampleIDColumn          = "library_id"
+	sampleObjectGroupColumn = "object_group"
+	sampleFilenameColumn    = "filename"
+	sampleNameColumn        = "name"
+	sampleColorColumn       = "color"
+)
+
+//defaultSampleColumns Attribute columns that are always allowed in a sample sheet
+var defaultSampleColumns = []string{sampleIDColumn, sampleNameColumn, sampleColorColumn, "condition", "growth_phase", "replicate", "strain"}
+
+//SampleSheet Maps the libraries of the wet lab to the object groups of a dataset
+type SampleSheet struct {
+	DatasetID string
+	//Columns Attribute columns in the order of the sheet
+	Columns []string
+	Samples []*Sample
+}
+
+//Sample A single row of a sample sheet
+//Before linking only one of ObjectGroupID and Filename might be set
+type Sample struct {
+	ObjectGroupID string
+	Filename      string
+	Attributes    map[string]string
+}
+
+//SampleSheetError Lists all problems found while validating a sample sheet
+type SampleSheetError struct {
+	Problems []string
+}
+
+func (err *SampleSheetError) Error() string {
+	return fmt.Sprintf("invalid sample sheet: %v", strings.Join(err.Problems, "; "))
+}
+
+//SampleSheetStore Stores the imported sample sheets as tsv files, one file per dataset
+type SampleSheetStore struct {
+	Dir string
+	//Columns Allowed attribute columns in addition to the default columns
+	Columns []string
+	mutex   sync.RWMutex
+}
+
+//NewSampleSheetStoreFromConfig Creates the store from the SampleSheets config section
+//Returns nil if no directory is configured, sample sheets are disabled in that case
+func NewSampleSheetStoreFromConfig() (*SampleSheetStore, error) {
+	dir := viper.GetString("SampleSheets.Dir")
+	if dir == "" {
+		return nil, nil
+	}
+
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	var columns []string
+	for _, column := range viper.GetStringSlice("SampleSheets.Columns") {
+		columns = append(columns, normalizeColumnName(column))
+	}
+
+	return &SampleSheetStore{
+		Dir:     dir,
+		Columns: columns,
+	}, nil
+}
+
+//ParseSampleSheet Reads and validates a csv or tsv sample sheet, the delimiter is detected from the filename or the header
+//Every row needs a library_id and an object_group or filename column to link it to the dataset
+func (store *SampleSheetStore) ParseSampleSheet(reader io.Reader, filename string) (*SampleSheet, error) {
+	bufferedReader := bufio.NewReader(reader)
+
+	csvReader := csv.NewReader(bufferedReader)
+	csvReader.Comment = '#'
+	csvReader.TrimLeadingSpace = true
+	csvReader.Comma = detectDelimiter(bufferedReader, filename)
+
+	header, err := csvReader.Read()
+	if err != nil {
+		return nil, &SampleSheetError{Problems: []string{fmt.Sprintf("could not read header: %v", err.Error())}}
+	}
+
+	var problems []string
+	allowedColumns := append(append([]string{sampleObjectGroupColumn, sampleFilenameColumn}, defaultSampleColumns...), store.Columns...)
+
+	columns := make([]string, len(header))
+	seenColumns := make(map[string]bool)
+	for i, column := range header {
+		columns[i] = normalizeColumnName(column)
+		if !containsAny([]string{columns[i]}, allowedColumns) {
+			problems = append(problems, fmt.Sprintf("unknown column: %v", column))
+		}
+		if seenColumns[columns[i]] {
+			problems = append(problems, fmt.Sprintf("duplicate column: %v", column))
+		}
+		seenColumns[columns[i]] = true
+	}
+
+	if !seenColumns[sampleIDColumn] {
+		problems = append(problems, fmt.Sprintf("missing column: %v", sampleIDColumn))
+	}
+	if !seenColumns[sampleObjectGroupColumn] && !seenColumns[sampleFilenameColumn] {
+		problems = append(problems, fmt.Sprintf("missing column: %v or %v", sampleObjectGroupColumn, sampleFilenameColumn))
+	}
+
+	if len(problems) > 0 {
+		return nil, &SampleSheetError{Problems: problems}
+	}
+
+	sheet := SampleSheet{}
+	for _, column := range columns {
+		if column != sampleObjectGroupColumn && column != sampleFilenameColumn {
+			sheet.Columns = append(sheet.Columns, column)
+		}
+	}
+
+	sampleIDs := make(map[string]bool)
+	for row := 1; ; row++ {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			problems = append(problems, err.Error())
+			break
+		}
+
+		sample := Sample{
+			Attributes: make(map[string]string),
+		}
+
+		for i, value := range record {
+			value = strings.TrimSpace(value)
+			switch columns[i] {
+			case sampleObjectGroupColumn:
+				sample.ObjectGroupID = value
+			case sampleFilenameColumn:
+				sample.Filename = value
+			default:
+				if value != "" {
+					sample.Attributes[columns[i]] = value
+				}
+			}
+		}
+
+		sampleID := sample.Attributes[sampleIDColumn]
+		switch {
+		case sampleID == "":
+			problems = append(problems, fmt.Sprintf("row %v: empty %v", row, sampleIDColumn))
+		case sampleIDs[sampleID]:
+			problems = append(problems, fmt.Sprintf("row %v: duplicate %v: %v", row, sampleIDColumn, sampleID))
+		}
+		sampleIDs[sampleID] = true
+
+		if sample.ObjectGroupID == "" && sample.Filename == "" {
+			problems = append(problems, fmt.Sprintf("row %v: neither %v nor %v is set", row, sampleObjectGroupColumn, sampleFilenameColumn))
+		}
+
+		sheet.Samples = append(sheet.Samples, &sample)
+	}
+
+	if len(sheet.Samples) == 0 {
+		problems = append(problems, "the sample sheet contains no samples")
+	}
+
+	if len(problems) > 0 {
+		return nil, &SampleSheetError{Problems: problems}
+	}
+
+	return &sheet, nil
+}
+
+//Link Resolves the object group of every sample by its id or by the filename of one of its objects
+func (sheet *SampleSheet) Link(datasetID string, objectGroups []*ObjectGroup) error {
+	var problems []string
+
+	groupIDs := make(map[string]bool)
+	groupsByFilename := make(map[string]string)
+	for _, objectGroup := range objectGroups {
+		groupIDs[objectGroup.ID] = true
+		for _, object := range objectGroup.Objects {
+			groupsByFilename[object.Filename] = objectGroup.ID
+		}
+	}
+
+	linkedGroups := make(map[string]string)
+	for _, sample := range sheet.Samples {
+		sampleID := sample.Attributes[sampleIDColumn]
+
+		if sample.ObjectGroupID == "" {
+			groupID, ok := groupsByFilename[sample.Filename]
+			if !ok {
+				problems = append(problems, fmt.Sprintf("sample %v: file %v is missing from the dataset", sampleID, sample.Filename))
+				continue
+			}
+			sample.ObjectGroupID = groupID
+		} else if !groupIDs[sample.ObjectGroupID] {
+			problems = append(problems, fmt.Sprintf("sample %v: object group %v is missing from the dataset", sampleID, sample.ObjectGroupID))
+			continue
+		}
+
+		if otherSampleID, ok := linkedGroups[sample.ObjectGroupID]; ok {
+			problems = append(problems, fmt.Sprintf("sample %v: object group %v is already linked to sample %v", sampleID, sample.ObjectGroupID, otherSampleID))
+			continue
+		}
+		linkedGroups[sample.ObjectGroupID] = sampleID
+	}
+
+	if len(problems) > 0 {
+		return &SampleSheetError{Problems: problems}
+	}
+
+	sheet.DatasetID = datasetID
+	return nil
+}
+
+//Save Stores a linked sample sheet, an existing sheet of the dataset is replaced
+func (store *SampleSheetStore) Save(sheet *SampleSheet) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	tmpFile, err := ioutil.TempFile(store.Dir, ".samplesheet-*")
+	if err != nil {
+		log.Println(err.Error())
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	writer := csv.NewWriter(tmpFile)
+	writer.Comma = '\t'
+	writer.Write(append([]string{sampleObjectGroupColumn}, sheet.Columns...))
+	for _, sample := range sheet.Samples {
+		record := []string{sample.ObjectGroupID}
+		for _, column := range sheet.Columns {
+			record = append(record, sample.Attributes[column])
+		}
+		writer.Write(record)
+	}
+	writer.Flush()
+
+	err = writer.Error()
+	if err == nil {
+		err = tmpFile.Close()
+	} else {
+		tmpFile.Close()
+	}
+	if err != nil {
+		log.Println(err.Error())
+		return err
+	}
+
+	return os.Rename(tmpFile.Name(), store.sheetPath(sheet.DatasetID))
+}
+
+//Attributes Returns the attributes of the samples of a dataset by object group id, nil if no sheet was imported
+func (store *SampleSheetStore) Attributes(datasetID string) (map[string]map[string]string, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	attributes, err := readMetadataTSV(store.sheetPath(datasetID))
+	if err != nil && os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	return attributes, err
+}
+
+func (store *SampleSheetStore) sheetPath(datasetID string) string {
+	return filepath.Join(store.Dir, url.PathEscape(datasetID)+".tsv")
+}
+
+//normalizeColumnName Column names are compared case insensitive, spaces and dashes are treated as underscores
+func normalizeColumnName(column string) string {
+	column = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))
+	return strings.NewReplacer(" ", "_", "-", "_").Replace(column)
+}
+
+//detectDelimiter Uses the extension of the file or a tab in the header line
+func detectDelimiter(reader *bufio.Reader, filename string) rune {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return ','
+	case ".tsv", ".tab":
+		return '\t'
+	}
+
+	header, _ := reader.Peek(4096)
+	firstLine := strings.SplitN(string(header), "\n", 2)[0]
+	if strings.Contains(firstLine, "\t") {
+		return '\t'
+	}
+
+	return ','
+}
+
+//ImportSampleSheet Validates a sample sheet against the current version of a dataset of the genome and stores it
+func (datahandler *DataHandler) ImportSampleSheet(ctx context.Context, genome *Genome, trackType TrackType, reader io.Reader, filename string, credentials Credentials) (*SampleSheet, error) {
+	if datahandler.SampleSheets == nil {
+		return nil, fmt.Errorf("sample sheets are not enabled, SampleSheets.Dir needs to be set")
+	}
+
+	if genome.datasetID(trackType) == "" {
+		return nil, fmt.Errorf("genome %v has no %v dataset", genome.ID, trackType)
+	}
+
+	sheet, err := datahandler.SampleSheets.ParseSampleSheet(reader, filename)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	datasetVersion, err := datahandler.getCurrentDatasetVersion(ctx, genome, trackType, credentials)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	objectGroups, err := datahandler.Source.GetDatasetObjectGroups(ctx, datasetVersion, credentials)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	err = sheet.Link(genome.datasetID(trackType), objectGroups)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	err = datahandler.SampleSheets.Save(sheet)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	return sheet, nil
+}
+
+//applySampleSheet Adds the attributes of the imported sample sheet to the object groups of a dataset
+//The attributes of the sample sheet take precedence over the metadata of the track source
+func (datahandler *DataHandler) applySampleSheet(datasetID string, objectGroups ...*ObjectGroup) error {
+	if datahandler.SampleSheets == nil || datasetID == "" {
+		return nil
+	}
+
+	sheetAttributes, err := datahandler.SampleSheets.Attributes(datasetID)
+	if err != nil {
+		log.Println(err.Error())
+		return err
+	}
+
+	for _, objectGroup := range objectGroups {
+		sampleAttributes, ok := sheetAttributes[objectGroup.ID]
+		if !ok {
+			continue
+		}
+
+		attributes := make(map[string]string)
+		for key, value := range objectGroup.Attributes {
+			attributes[key] = value
+		}
+		for key, value := range sampleAttributes {
+			attributes[key] = value
+		}
+		objectGroup.Attributes = attributes
+	}
+
+	return nil
+}
+
+//UploadSampleSheet Imports the sample sheet in the samplesheet form file for a dataset of the genome, e.g. Bigwigs
+//Only admins may upload sample sheets, validation problems are returned with status 422
+func (browser *BrowserEndpoints) UploadSampleSheet(c *gin.Context) {
+	user := UserFromGinContext(c)
+	if user == nil {
+		abortWithDataError(c, errNotLoggedIn)
+		return
+	}
+	if !browser.Access.IsAdmin(user) {
+		abortWithErrorResponse(c, 403, "forbidden", errors.New("only admins may upload sample sheets"))
+		return
+	}
+
+	genome, ok := browser.DataHandler.GetGenome(c.Param("genome"))
+	if !ok {
+		abortWithDataError(c, &NotFoundError{Resource: "genome", ID: c.Param("genome")})
+		return
+	}
+
+	trackType, ok := datasetConfigKeys[c.Param("dataset")]
+	if !ok {
+		abortWithDataError(c, &NotFoundError{Resource: "dataset key", ID: c.Param("dataset")})
+		return
+	}
+
+	credentials, err := browser.AutHandler.CredentialsFromGinContext(c)
+	if err != nil {
+		abortWithDataError(c, err)
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, sampleSheetMaxSize)
+	fileHeader, err := c.FormFile("samplesheet")
+	if err != nil {
+		abortWithDataError(c, &InvalidRequestError{Err: err})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		abortWithDataError(c, &InvalidRequestError{Err: err})
+		return
+	}
+	defer file.Close()
+
+	//Validation problems are listed in the details of the error response
+	sheet, err := browser.DataHandler.ImportSampleSheet(c.Request.Context(), genome, trackType, file, fileHeader.Filename, credentials)
+	if err != nil {
+		abortWithDataError(c, err)
+		return
+	}
+
+	log.Println(fmt.Sprintf("AUDIT samplesheet: user=%v (%v) genome=%v dataset=%v samples=%v", user.Subject, user.Email, genome.ID, trackType, len(sheet.Samples)))
+
+	c.JSON(200, gin.H{
+		"dataset": sheet.DatasetID,
+		"columns": sheet.Columns,
+		"samples": len(sheet.Samples),
+	})
+}
+
+//ImportSampleSheetFile Imports a sample sheet from the command line with the service token in the APIToken environment variable
+//The genome defaults to the first configured genome
+func ImportSampleSheetFile(genomeID string, datasetKey string, sheetPath string) (*SampleSheet, error) {
+	genomes, err := NewGenomesFromConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	genome := genomes[0]
+	if genomeID != "" {
+		datahandler := DataHandler{Genomes: genomes}
+		selectedGenome, ok := datahandler.GetGenome(genomeID)
+		if !ok {
+			return nil, fmt.Errorf("unknown genome: %v", genomeID)
+		}
+		genome = selectedGenome
+	}
+
+	trackType, ok := datasetConfigKeys[datasetKey]
+	if !ok {
+		return nil, fmt.Errorf("unknown dataset: %v", datasetKey)
+	}
+
+	source, err := createTrackSource(AuthHandler{})
+	if err != nil {
+		return nil, err
+	}
+
+	sampleSheets, err := NewSampleSheetStoreFromConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(sheetPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	datahandler := DataHandler{
+		Source:       source,
+		Genomes:      genomes,
+		SampleSheets: sampleSheets,
+	}
+
+	credentials := Credentials{
+		Token:     os.Getenv("APIToken"),
+		TokenType: client.UserAPIToken,
+	}
+
+	return datahandler.ImportSampleSheet(context.Background(), genome, trackType, file, filepath.Base(sheetPath), credentials)
+}
@@ -3,7 +3,10 @@ package server
 import (
 	"fmt"
 	"log"
+	"net/http"
+	"os"
 	"strconv"
+	"time"
 
 	"github.com/ag-computational-bio/BioDataDBModels/go/client"
 
@@ -15,80 +18,226 @@ import (
 
 //Run Starts the webserver and reads the config
 func Run() {
-	//Load the required config
-	host := viper.GetString("Endpoints.DatasetHandler.Host")
-	if host == "" {
-		err := fmt.Errorf("Endpoints datasethandler host needs to be set")
+	//The dataset ids are from the BioDataDB or the directory names of the local backend
+	genomes, err := NewGenomesFromConfig()
+	if err != nil {
 		log.Fatalln(err.Error())
 	}
 
-	port := viper.GetInt("Endpoints.DatasetHandler.Port")
-	if port == 0 {
-		err := fmt.Errorf("Endpoints datasethandler port needs to be set")
+	//Init the authhandler
+	//Will only be used until the publication of the project
+	authhandler := AuthHandler{}
+	authhandler.Init()
+
+	source, err := createTrackSource(authhandler)
+	if err != nil {
 		log.Fatalln(err.Error())
 	}
 
-	//The ids are from the BioDataDB
-	bigWigsID := viper.GetString("Datasets.Bigwigs")
-	bamID := viper.GetString("Datasets.Bam")
-	referenceID := viper.GetString("Datasets.Reference")
-	gffID := viper.GetString("Datasets.GFFAnnotation")
+	strands, err := NewStrandPatternsFromConfig()
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
 
-	//Establish the grpc client to connect to the BioDataDB
-	grpcClients := client.GRPCEndpointsClients{}
-	err := grpcClients.New(host, strconv.Itoa(port))
+	sampleSheets, err := NewSampleSheetStoreFromConfig()
 	if err != nil {
 		log.Fatalln(err.Error())
 	}
 
-	//Init the authhandler
-	//Will only be used until the publication of the project
-	authhandler := AuthHandler{}
-	authhandler.Init()
+	//Files of the local backend are served by the server itself, their urls do not expire
+	var links *LinkProxy
+	if _, ok := source.(*LocalSource); !ok {
+		links = NewLinkProxyFromConfig()
+		go links.CleanupPeriodically(10 * time.Minute)
+	}
+
+	//Also used as the deadline of the shared loads of the cache
+	viper.SetDefault("Backend.CallTimeout", "10s")
 
 	datahandler := DataHandler{
-		AutHandler:        authhandler,
-		BWDatsetID:        bigWigsID,
-		BamDatasetID:      bamID,
-		FastaRefDatasetID: referenceID,
-		GFFDatasetID:      gffID,
-		GRPCEndpoints:     grpcClients,
+		Source:         NewCachedSourceFromConfig(source),
+		Genomes:        genomes,
+		GenotypeColors: NewGenotypeColorsFromConfig(),
+		Strands:        strands,
+		GroupBy:        viper.GetString("Tracks.GroupBy"),
+		SampleSheets:   sampleSheets,
+		Links:          links,
+		CallTimeout:    viper.GetDuration("Backend.CallTimeout"),
+	}
+
+	accessPolicy, err := NewAccessPolicyFromConfig()
+	if err != nil {
+		log.Fatalln(err.Error())
 	}
 
 	browserEndpoints := BrowserEndpoints{
 		DataHandler: datahandler,
 		AutHandler:  authhandler,
+		Access:      accessPolicy,
+	}
+
+	browserSessionStore, err := NewBrowserSessionStoreFromConfig()
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+
+	browserSessionEndpoints := BrowserSessionEndpoints{
+		Store:       browserSessionStore,
+		DataHandler: datahandler,
+		Browser:     &browserEndpoints,
+		ExternalURL: viper.GetString("BrowserSessions.ExternalURL"),
 	}
 
-	router := gin.Default()
+	go authhandler.Sessions.CleanupPeriodically(10 * time.Minute)
+
+	//The readiness checks use the service token, datasets can not be checked with the user token strategy
+	healthChecks := []HealthCheck{
+		datasetsCheck(datahandler.Source, genomes, Credentials{
+			Token:     authhandler.ServiceToken,
+			TokenType: client.UserAPIToken,
+		}),
+		oidcCheck(authhandler.OIDCVerifier.IssuerURL, &http.Client{}),
+	}
+	if biodatadb, ok := source.(*BioDataDBSource); ok {
+		healthChecks = append(healthChecks, grpcConnectionCheck(biodatadb.Conn))
+	}
+	healthEndpoints := NewHealthEndpointsFromConfig(healthChecks...)
+
+	router := gin.New()
+	//The probes of kubernetes would fill the log
+	router.Use(gin.LoggerWithConfig(gin.LoggerConfig{SkipPaths: []string{"/healthz", "/readyz"}}), gin.Recovery())
+	router.Use(RequestID)
 
 	router.HTMLRender = createMyRender()
 	router.Static("./static", "./static")
 
-	//Temporary solution until final publication to restric access
-	router.Use(authhandler.UpdateToken)
+	//Registered before the session middleware, the probes do not need a login
+	router.GET("/healthz", healthEndpoints.Liveness)
+	router.GET("/readyz", healthEndpoints.Readiness)
+
+	//Restricts access until the publication, in public mode a login is only required for private datasets
+	if authhandler.PublicMode {
+		router.Use(authhandler.OptionalSession)
+	} else {
+		router.Use(authhandler.UpdateToken)
+	}
 
 	router.GET("/", base)
 	router.GET("/index", index)
 	router.GET("/auth/callback", authhandler.Callback)
 	router.GET("/login", authhandler.Auth)
+	router.GET("/logout", authhandler.Logout)
+
+	genomeGroup := router.Group("/data/genomes/:genome")
+	genomeGroup.GET("/default", browserEndpoints.GetDefaultTrackConfig)
+	genomeGroup.GET("/bigWigsTrack/:id", browserEndpoints.GetBigWigsTracks)
+	genomeGroup.GET("/bamTrack/:id", browserEndpoints.GetBamTrack)
+	genomeGroup.GET("/cramTrack/:id", browserEndpoints.GetCramTrack)
+	genomeGroup.GET("/vcfTrack/:id", browserEndpoints.GetVcfTrack)
+	genomeGroup.GET("/featuresTrack/:id", browserEndpoints.GetFeaturesTrack)
+	genomeGroup.POST("/samplesheets/:dataset", browserEndpoints.UploadSampleSheet)
+
+	//Files are only served by the server itself if they are stored in the local backend
+	if localSource, ok := source.(*LocalSource); ok {
+		fileEndpoints := FileEndpoints{
+			Source:      localSource,
+			DataHandler: datahandler,
+			Access:      accessPolicy,
+		}
+
+		router.GET(localFilesPath+"/*path", fileEndpoints.GetFile)
+		router.HEAD(localFilesPath+"/*path", fileEndpoints.GetFile)
+	}
+
+	if links != nil {
+		linkEndpoints := LinkEndpoints{
+			Links:       links,
+			DataHandler: datahandler,
+			AutHandler:  authhandler,
+			Access:      accessPolicy,
+		}
+
+		router.GET(linksPath+"/:group/:object/*filename", linkEndpoints.GetObject)
+		router.HEAD(linksPath+"/:group/:object/*filename", linkEndpoints.GetObject)
+	}
+
+	if cache, ok := datahandler.Source.(*CachedSource); ok {
+		replica, err := os.Hostname()
+		if err != nil {
+			log.Println(err.Error())
+		}
 
-	dataGroup := router.Group("/data")
-	dataGroup.GET("/default", browserEndpoints.GetDefaultTrackConfig)
-	dataGroup.GET("/bigWigsTrack/:id", browserEndpoints.GetBigWigsTracks)
-	dataGroup.GET("/bamTrack/:id", browserEndpoints.GetBamTrack)
+		cacheEndpoints := CacheEndpoints{
+			Cache:   cache,
+			Access:  accessPolicy,
+			Replica: replica,
+		}
+
+		router.POST("/admin/cache/invalidate", cacheEndpoints.Invalidate)
+	}
 
 	browserGroup := router.Group("/browser")
 	browserGroup.GET("/", browserEndpoints.IGVBrowser)
+	browserGroup.GET("/s/:id", browserSessionEndpoints.Restore)
+
+	sessionGroup := router.Group("/sessions")
+	sessionGroup.GET("", browserSessionEndpoints.List)
+	sessionGroup.POST("", browserSessionEndpoints.Create)
+	sessionGroup.POST("/import", browserSessionEndpoints.ImportIGVSession)
+	sessionGroup.GET("/:id", browserSessionEndpoints.Get)
+	sessionGroup.PUT("/:id", browserSessionEndpoints.Update)
+	sessionGroup.DELETE("/:id", browserSessionEndpoints.Delete)
+	sessionGroup.GET("/:id/igv.json", browserSessionEndpoints.ExportIGVSession)
 
 	router.Run()
 }
 
+//createTrackSource Creates the track source configured in Backend.Type, defaults to the BioDataDB
+func createTrackSource(authhandler AuthHandler) (TrackSource, error) {
+	backendType := viper.GetString("Backend.Type")
+
+	switch backendType {
+	case "", "biodatadb":
+		//Load the required config
+		host := viper.GetString("Endpoints.DatasetHandler.Host")
+		if host == "" {
+			return nil, fmt.Errorf("Endpoints datasethandler host needs to be set")
+		}
+
+		port := viper.GetInt("Endpoints.DatasetHandler.Port")
+		if port == 0 {
+			return nil, fmt.Errorf("Endpoints datasethandler port needs to be set")
+		}
+
+		calls, err := NewCallPolicyFromConfig()
+		if err != nil {
+			return nil, err
+		}
+
+		//Establish the grpc client to connect to the BioDataDB
+		return NewBioDataDBSource(host, strconv.Itoa(port), authhandler, calls)
+	case "local":
+		root := viper.GetString("Backend.Local.Root")
+		if root == "" {
+			return nil, fmt.Errorf("Backend local root needs to be set")
+		}
+
+		return &LocalSource{
+			Root: root,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown backend type: %v", backendType)
+	}
+}
+
 func createMyRender() multitemplate.Renderer {
 	r := multitemplate.NewRenderer()
 
 	r.AddFromFiles("index.html", "templates/index.html", "templates/baseTopBar.html", "templates/baseHeader.html")
 	r.AddFromFiles("browser.html", "templates/browser.html", "templates/baseTopBar.html", "templates/baseHeader.html")
+	r.AddFromFiles("autherror.html", "templates/autherror.html", "templates/baseHeader.html")
+	r.AddFromFiles("error.html", "templates/error.html", "templates/baseHeader.html")
+	r.AddFromFiles("logout.html", "templates/logout.html", "templates/baseHeader.html")
 
 	return r
 }
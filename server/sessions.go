@@ -0,0 +1,212 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"golang.org/x/oauth2"
+)
+
+var errSessionNotFound = errors.New("session not found")
+
+//Session Server side state of a logged in user, the browser only knows the id
+type Session struct {
+	ID       string        `json:"id"`
+	Token    *oauth2.Token `json:"token"`
+	User     *UserInfo     `json:"user"`
+	Created  time.Time     `json:"created"`
+	LastSeen time.Time     `json:"lastSeen"`
+}
+
+//SessionStore Persists the sessions of logged in users
+type SessionStore interface {
+	//Get Returns the session with the given id or errSessionNotFound
+	Get(id string) (*Session, error)
+	//Save Creates or replaces a session
+	Save(session *Session) error
+	//Delete Removes a session, deleting an unknown session is not an error
+	Delete(id string) error
+	//DeleteExpired Removes all sessions for which expired returns true
+	DeleteExpired(expired func(session *Session) bool) error
+}
+
+//SessionManager Creates sessions and enforces their idle and absolute timeouts
+type SessionManager struct {
+	Store           SessionStore
+	IdleTimeout     time.Duration
+	AbsoluteTimeout time.Duration
+}
+
+//lastSeenResolution Minimal time between two updates of the last seen time, avoids a write on every request
+const lastSeenResolution = time.Minute
+
+//NewSessionManagerFromConfig Creates the session manager configured in the Sessions section
+func NewSessionManagerFromConfig() (*SessionManager, error) {
+	viper.SetDefault("Sessions.Store", "memory")
+	viper.SetDefault("Sessions.IdleTimeout", "2h")
+	viper.SetDefault("Sessions.AbsoluteTimeout", "15h")
+
+	manager := SessionManager{
+		IdleTimeout:     viper.GetDuration("Sessions.IdleTimeout"),
+		AbsoluteTimeout: viper.GetDuration("Sessions.AbsoluteTimeout"),
+	}
+
+	storeType := viper.GetString("Sessions.Store")
+	switch storeType {
+	case "memory":
+		manager.Store = NewMemorySessionStore()
+	case "file":
+		store, err := NewFileSessionStoreFromConfig()
+		if err != nil {
+			return nil, err
+		}
+		manager.Store = store
+	default:
+		return nil, fmt.Errorf("unknown session store: %v", storeType)
+	}
+
+	return &manager, nil
+}
+
+//Create Creates and stores a new session for the token of a verified user
+func (manager *SessionManager) Create(token *oauth2.Token, user *UserInfo) (*Session, error) {
+	id, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := Session{
+		ID:       id,
+		Token:    token,
+		User:     user,
+		Created:  now,
+		LastSeen: now,
+	}
+
+	err = manager.Store.Save(&session)
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+//Load Returns a session that has not timed out yet and marks it as seen
+func (manager *SessionManager) Load(id string) (*Session, error) {
+	session, err := manager.Store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if manager.expired(session, now) {
+		err := manager.Store.Delete(id)
+		if err != nil {
+			log.Println(err.Error())
+		}
+		return nil, errSessionNotFound
+	}
+
+	if now.Sub(session.LastSeen) > lastSeenResolution {
+		session.LastSeen = now
+		err := manager.Store.Save(session)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return session, nil
+}
+
+//UpdateToken Replaces the token of a session, e.g. after a refresh
+func (manager *SessionManager) UpdateToken(session *Session, token *oauth2.Token) error {
+	session.Token = token
+	return manager.Store.Save(session)
+}
+
+//Revoke Deletes a session, used for the logout
+func (manager *SessionManager) Revoke(id string) error {
+	return manager.Store.Delete(id)
+}
+
+//CleanupPeriodically Removes expired sessions from the store in the given interval, blocks forever
+func (manager *SessionManager) CleanupPeriodically(interval time.Duration) {
+	for range time.Tick(interval) {
+		err := manager.Store.DeleteExpired(func(session *Session) bool {
+			return manager.expired(session, time.Now())
+		})
+		if err != nil {
+			log.Println(err.Error())
+		}
+	}
+}
+
+func (manager *SessionManager) expired(session *Session, now time.Time) bool {
+	return now.Sub(session.LastSeen) > manager.IdleTimeout || now.Sub(session.Created) > manager.AbsoluteTimeout
+}
+
+//MemorySessionStore Keeps the sessions in memory
+//Sessions are lost on restart and not shared between replicas, requires sticky sessions if scaled
+type MemorySessionStore struct {
+	mutex    sync.Mutex
+	sessions map[string]Session
+}
+
+//NewMemorySessionStore Creates an empty in-memory session store
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		sessions: make(map[string]Session),
+	}
+}
+
+//Get Returns a copy of the stored session
+func (store *MemorySessionStore) Get(id string) (*Session, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	session, ok := store.sessions[id]
+	if !ok {
+		return nil, errSessionNotFound
+	}
+
+	return &session, nil
+}
+
+//Save Stores a copy of the session
+func (store *MemorySessionStore) Save(session *Session) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.sessions[session.ID] = *session
+
+	return nil
+}
+
+//Delete Removes a session
+func (store *MemorySessionStore) Delete(id string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	delete(store.sessions, id)
+
+	return nil
+}
+
+//DeleteExpired Removes all expired sessions
+func (store *MemorySessionStore) DeleteExpired(expired func(session *Session) bool) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for id, session := range store.sessions {
+		if expired(&session) {
+			delete(store.sessions, id)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+//Strand Strand of a coverage file
+type Strand string
+
+const (
+	StrandNone    Strand = ""
+	StrandForward Strand = "+"
+	StrandReverse Strand = "-"
+)
+
+//StrandPatterns Recognises forward and reverse coverage files by their names
+//The patterns are matched against the filename without extension, the matched part is removed to get the sample name
+type StrandPatterns struct {
+	Forward      []*regexp.Regexp
+	Reverse      []*regexp.Regexp
+	ForwardColor string
+	ReverseColor string
+}
+
+//NewStrandPatternsFromConfig Reads the strand patterns and colors from the BigWigs config section
+func NewStrandPatternsFromConfig() (*StrandPatterns, error) {
+	viper.SetDefault("BigWigs.ForwardPatterns", []string{`[_.-](fwd|forward|plus|pos)$`})
+	viper.SetDefault("BigWigs.ReversePatterns", []string{`[_.-](rev|reverse|minus|neg)$`})
+	viper.SetDefault("BigWigs.ForwardColor", "rgb(0, 0, 150)")
+	viper.SetDefault("BigWigs.ReverseColor", "rgb(150, 0, 0)")
+
+	forward, err := compilePatterns(viper.GetStringSlice("BigWigs.ForwardPatterns"))
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	reverse, err := compilePatterns(viper.GetStringSlice("BigWigs.ReversePatterns"))
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	return &StrandPatterns{
+		Forward:      forward,
+		Reverse:      reverse,
+		ForwardColor: viper.GetString("BigWigs.ForwardColor"),
+		ReverseColor: viper.GetString("BigWigs.ReverseColor"),
+	}, nil
+}
+
+//compilePatterns Compiles case insensitive patterns
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, pattern := range patterns {
+		regex, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid strand pattern: %v: %v", pattern, err.Error())
+		}
+
+		compiled = append(compiled, regex)
+	}
+
+	return compiled, nil
+}
+
+//StrandOf Returns the strand of a file and its name without strand suffix and extension
+func (patterns *StrandPatterns) StrandOf(filename string) (Strand, string) {
+	name := strings.TrimSuffix(filename, path.Ext(filename))
+
+	for _, regex := range patterns.Forward {
+		if regex.MatchString(name) {
+			return StrandForward, regex.ReplaceAllString(name, "")
+		}
+	}
+
+	for _, regex := range patterns.Reverse {
+		if regex.MatchString(name) {
+			return StrandReverse, regex.ReplaceAllString(name, "")
+		}
+	}
+
+	return StrandNone, name
+}
+
+//strandedTracks Combines the forward and reverse file of a sample into an igv.js merged track
+//Files without a recognised strand or without a partner are returned as single wig tracks
+func (patterns *StrandPatterns) strandedTracks(files []*ClassifiedObject) []Track {
+	var tracks []Track
+
+	var sampleNames []string
+	samples := make(map[string][]*ClassifiedObject)
+	for _, file := range files {
+		strand, sampleName := patterns.StrandOf(file.Filename)
+		if strand == StrandNone {
+			tracks = append(tracks, patterns.wigTrack(file, StrandNone))
+			continue
+		}
+
+		if _, ok := samples[sampleName]; !ok {
+			sampleNames = append(sampleNames, sampleName)
+		}
+		samples[sampleName] = append(samples[sampleName], file)
+	}
+
+	for _, sampleName := range sampleNames {
+		sampleFiles := samples[sampleName]
+		if len(sampleFiles) == 1 {
+			strand, _ := patterns.StrandOf(sampleFiles[0].Filename)
+			tracks = append(tracks, patterns.wigTrack(sampleFiles[0], strand))
+			continue
+		}
+
+		merged := Track{
+			Name:       sampleName,
+			Type:       "merged",
+			AutoScale:  true,
+			GuideLines: []GuideLine{{Color: "grey", Dotted: true, Y: 0}},
+		}
+
+		//Forward files are drawn first, the reverse coverage is mirrored below the shared axis
+		for _, wantedStrand := range []Strand{StrandForward, StrandReverse} {
+			for _, file := range sampleFiles {
+				if strand, _ := patterns.StrandOf(file.Filename); strand == wantedStrand {
+					track := patterns.wigTrack(file, strand)
+					if strand == StrandReverse {
+						//igv.js draws negative values with the altColor
+						track.Mirror = true
+						track.AltColor = track.Color
+					}
+					merged.Tracks = append(merged.Tracks, track)
+				}
+			}
+		}
+
+		tracks = append(tracks, merged)
+	}
+
+	return tracks
+}
+
+//wigTrack Returns a wig track colored by the strand of the file
+func (patterns *StrandPatterns) wigTrack(file *ClassifiedObject, strand Strand) Track {
+	color := patterns.ForwardColor
+	if strand == StrandReverse {
+		color = patterns.ReverseColor
+	}
+
+	return Track{
+		Color:     color,
+		AutoScale: true,
+		Type:      "wig",
+		Format:    string(file.Format),
+		Name:      file.Filename,
+		URL:       file.URL,
+	}
+}
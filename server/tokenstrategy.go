@@ -0,0 +1,70 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ag-computational-bio/BioDataDBModels/go/client"
+	"github.com/gin-gonic/gin"
+)
+
+//TokenStrategy Decides which token is used for calls to the track source
+type TokenStrategy string
+
+const (
+	//UserTokenStrategy Uses the oauth2 token of the logged in user
+	UserTokenStrategy TokenStrategy = "user"
+	//ServiceTokenStrategy Uses the api token of the service for all users
+	ServiceTokenStrategy TokenStrategy = "service"
+	//UserWithServiceFallbackStrategy Uses the token of the user if available, the service token otherwise
+	UserWithServiceFallbackStrategy TokenStrategy = "user-service-fallback"
+)
+
+var errNoCredentials = errors.New("no token available for the configured token strategy")
+
+//Credentials Token and its type used to authenticate calls to the track source
+type Credentials struct {
+	Token     string
+	TokenType client.TokenType
+}
+
+//parseTokenStrategy Parses the token strategy from the config, defaults to the token of the user
+func parseTokenStrategy(value string) (TokenStrategy, error) {
+	switch TokenStrategy(value) {
+	case "":
+		return UserTokenStrategy, nil
+	case UserTokenStrategy, ServiceTokenStrategy, UserWithServiceFallbackStrategy:
+		return TokenStrategy(value), nil
+	default:
+		return "", fmt.Errorf("unknown token strategy: %v", value)
+	}
+}
+
+//CredentialsFromGinContext Returns the credentials for a request according to the configured token strategy
+func (handler *AuthHandler) CredentialsFromGinContext(c *gin.Context) (Credentials, error) {
+	serviceCredentials := Credentials{
+		Token:     handler.ServiceToken,
+		TokenType: client.UserAPIToken,
+	}
+
+	if handler.TokenStrategy == ServiceTokenStrategy {
+		if handler.ServiceToken == "" {
+			return Credentials{}, errNoCredentials
+		}
+		return serviceCredentials, nil
+	}
+
+	userToken := handler.GetAccessTokenFromGinContext(c)
+	if userToken != "" {
+		return Credentials{
+			Token:     userToken,
+			TokenType: client.AccessToken,
+		}, nil
+	}
+
+	if handler.TokenStrategy == UserWithServiceFallbackStrategy && handler.ServiceToken != "" {
+		return serviceCredentials, nil
+	}
+
+	return Credentials{}, errNoCredentials
+}
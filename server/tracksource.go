@@ -0,0 +1,40 @@
+package server
+
+import "context"
+
+//TrackSource Abstracts the storage backend that provides datasets and their track files
+//The BioDataDB implementation is used in production, the local implementation serves files from disk
+type TrackSource interface {
+	//GetCurrentDatasetVersion Returns the current version of the dataset with the given id
+	GetCurrentDatasetVersion(ctx context.Context, datasetID string, credentials Credentials) (*DatasetVersion, error)
+	//GetDatasetObjectGroups Returns all object groups of a dataset version without download links
+	GetDatasetObjectGroups(ctx context.Context, datasetVersion *DatasetVersion, credentials Credentials) ([]*ObjectGroup, error)
+	//GetDatasetDownloadLinks Returns all object groups of a dataset version including their download links
+	GetDatasetDownloadLinks(ctx context.Context, datasetVersion *DatasetVersion, credentials Credentials) ([]*ObjectGroup, error)
+	//GetObjectGroup Returns a single object group including its download links
+	GetObjectGroup(ctx context.Context, groupID string, credentials Credentials) (*ObjectGroup, error)
+}
+
+//DatasetVersion A specific version of a dataset
+type DatasetVersion struct {
+	ID        string
+	DatasetID string
+}
+
+//ObjectGroup A group of objects that belong together, e.g. a bam file and its index
+type ObjectGroup struct {
+	ID        string
+	Name      string
+	DatasetID string
+	Objects   []*Object
+	//Attributes Sample attributes of the group, e.g. condition, growth phase, replicate or strain
+	Attributes map[string]string
+}
+
+//Object A single file of an object group
+//URL is only set if the download links of the group have been requested
+type Object struct {
+	ID       string
+	Filename string
+	URL      string
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+//GenotypeColors Colors of the genotype calls in igv.js variant tracks
+type GenotypeColors struct {
+	HomVar string
+	HetVar string
+	HomRef string
+	NoCall string
+}
+
+//VariantOptions Display options of a single variant track, usually taken from the request
+type VariantOptions struct {
+	//ColorBy Name of an INFO field used to color the variant sites, e.g. AF
+	ColorBy string
+	//Samples Names of the samples whose genotypes are shown, all samples are shown if empty
+	Samples []string
+}
+
+//NewGenotypeColorsFromConfig Reads the genotype colors from the Variants config section, the defaults are the igv.js colors
+func NewGenotypeColorsFromConfig() GenotypeColors {
+	viper.SetDefault("Variants.HomVarColor", "rgb(17,248,254)")
+	viper.SetDefault("Variants.HetVarColor", "rgb(34,12,253)")
+	viper.SetDefault("Variants.HomRefColor", "rgb(200,200,200)")
+	viper.SetDefault("Variants.NoCallColor", "rgb(250,250,250)")
+
+	return GenotypeColors{
+		HomVar: viper.GetString("Variants.HomVarColor"),
+		HetVar: viper.GetString("Variants.HetVarColor"),
+		HomRef: viper.GetString("Variants.HomRefColor"),
+		NoCall: viper.GetString("Variants.NoCallColor"),
+	}
+}
+
+//GetVcfList List of the vcf files of a genome
+func (datahandler *DataHandler) GetVcfList(ctx context.Context, genome *Genome, credentials Credentials, permissions *Permissions) (map[string][]FileGroup, error) {
+	return datahandler.getFileGroupList(ctx, genome, VCF, []FileFormat{FormatVCF}, credentials, permissions)
+}
+
+//GetVcfTrack Returns a variant track for every vcf file of an object group
+//Bgzip compressed files are loaded with their tabix index, plain vcf files are loaded completely by igv.js
+func (datahandler *DataHandler) GetVcfTrack(ctx context.Context, genome *Genome, id string, credentials Credentials, permissions *Permissions, options VariantOptions) ([]Track, error) {
+	classifiedGroup, vcfFiles, err := datahandler.getTrackFiles(ctx, genome, VCF, []FileFormat{FormatVCF}, id, credentials, permissions)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	var tracks []Track
+
+	for _, vcfFile := range vcfFiles {
+		index, err := classifiedGroup.IndexFor(vcfFile)
+		if err != nil {
+			log.Println(err.Error())
+			return nil, err
+		}
+
+		track := Track{
+			Type:        "variant",
+			Format:      string(vcfFile.Format),
+			Name:        vcfFile.Filename,
+			URL:         vcfFile.URL,
+			DisplayMode: "EXPANDED",
+			ColorBy:     options.ColorBy,
+			HomVarColor: datahandler.GenotypeColors.HomVar,
+			HetVarColor: datahandler.GenotypeColors.HetVar,
+			HomRefColor: datahandler.GenotypeColors.HomRef,
+			NoCallColor: datahandler.GenotypeColors.NoCall,
+			Samples:     options.Samples,
+		}
+
+		if index != nil {
+			track.IndexURL = index.URL
+		}
+
+		tracks = append(tracks, track)
+	}
+
+	return withAttributes(tracks, classifiedGroup.Group.Attributes), nil
+}
+
+//parseSampleNames Splits comma separated sample names, e.g. from repeated query parameters
+func parseSampleNames(values []string) []string {
+	var samples []string
+	for _, value := range values {
+		for _, sample := range strings.Split(value, ",") {
+			sample = strings.TrimSpace(sample)
+			if sample != "" {
+				samples = append(samples, sample)
+			}
+		}
+	}
+
+	return samples
+}
@@ -1,9 +1,95 @@
-fetch("/data/default", {method: "GET", credentials: "same-origin"})
-.catch((error) => {
-  console.error('Error:', error);
-}).then(data => { return data.json()}).then(defaultData => initIGV(defaultData))
+document.addEventListener("DOMContentLoaded", function () {
+  var igvDiv = document.getElementById("igv-div-1");
+  if (igvDiv == null) {
+    return
+  }
+
+  currentGenome = igvDiv.dataset.genome
+  fetchJSON(genomePath() + "/default")
+  .then(defaultData => initIGV(defaultData))
+  .catch(error => showError("Could not load the genome", error))
+})
+
+//fetchJSON Requests a JSON response, failed requests are rejected with the message of the JSON error body
+function fetchJSON(path, options) {
+  return fetch(path, Object.assign({method: "GET", credentials: "same-origin"}, options)).then(response => {
+    if (response.ok) {
+      return response.json()
+    }
+    return response.json().catch(() => ({})).then(body => {
+      var details = body.error || {}
+      var error = new Error(details.message || response.statusText || ("Request failed with status " + response.status))
+      error.status = response.status
+      error.details = details.details || []
+      error.requestId = details.requestId || response.headers.get("X-Request-ID")
+      error.retryAfter = response.headers.get("Retry-After")
+      throw error
+    })
+  })
+}
+
+//showError Shows a failed request as toast in the corner of the page, the toast is removed after some seconds
+function showError(title, error) {
+  console.error(title + ':', error)
+
+  var container = document.getElementById("toasts")
+  if (container == null) {
+    container = document.createElement("div")
+    container.id = "toasts"
+    document.body.appendChild(container)
+  }
+
+  var toast = document.createElement("div")
+  toast.className = "alert alert-danger alert-dismissible error-toast"
+  toast.setAttribute("role", "alert")
+
+  var heading = document.createElement("strong")
+  heading.textContent = title
+  toast.appendChild(heading)
+
+  var message = document.createElement("div")
+  message.textContent = error.message
+  if (error.retryAfter) {
+    message.textContent += " Please try again in " + error.retryAfter + " seconds."
+  }
+  toast.appendChild(message)
+
+  for (let detail of error.details || []) {
+    var item = document.createElement("div")
+    item.className = "small"
+    item.textContent = detail
+    toast.appendChild(item)
+  }
 
+  //Anonymous users of the public mode need a login for private datasets
+  if (error.status == 401) {
+    var login = document.createElement("a")
+    login.href = "/login"
+    login.textContent = "Login"
+    toast.appendChild(login)
+  }
+
+  if (error.requestId) {
+    var requestId = document.createElement("div")
+    requestId.className = "small text-muted"
+    requestId.textContent = "Request id: " + error.requestId
+    toast.appendChild(requestId)
+  }
 
+  var close = document.createElement("button")
+  close.type = "button"
+  close.className = "close"
+  close.innerHTML = "&times;"
+  close.onclick = () => toast.remove()
+  toast.appendChild(close)
+
+  container.appendChild(toast)
+  setTimeout(() => toast.remove(), 10000)
+}
+
+function genomePath() {
+  return "/data/genomes/" + encodeURIComponent(currentGenome)
+}
 
 function initIGV(defaultData) {
     var igvDiv = document.getElementById("igv-div-1");
@@ -11,29 +97,253 @@ function initIGV(defaultData) {
     .then(function (browser) {
         igvBrowser = browser;
         console.log("Created IGV browser 1");
+        if (igvDiv.dataset.session) {
+          restoreSession(igvDiv.dataset.session)
+        }
     })
 }
 
+//loadedTracks Tracks added from the menus, they are stored when the view is saved
+var loadedTracks = []
+
+//loadTracks Fetches the track configs of an object group and adds them to the browser
+//settings are the saved settings of a restored track and replace the defaults of the server
+function loadTracks(kind, id, params, settings) {
+  var fullPath = genomePath() + "/" + kind + "/" + id
+  if (params && params.toString()) {
+    fullPath += "?" + params.toString()
+  }
+
+  return fetchJSON(fullPath).then(tracks => {
+    if (settings) {
+      tracks = tracks.map(track => applySettings(track, settings))
+    }
+    return addTrack(tracks)
+  }).then(igvTracks => {
+    loadedTracks.push({kind: kind, id: id, tracks: igvTracks})
+  }).catch(error => showError("Could not load the track", error))
+}
+
 function addBigWigsTrack(id) {
-  var basePath = "/data/bigWigsTrack/"
-  var fullPath = basePath + id
-  fetch(fullPath, {method: "GET", credentials: "same-origin"})
-  .catch((error) => {
-  console.error('Error:', error);
-}).then(data => { return data.json()}).then(tracks => addTrack(tracks))
+  loadTracks("bigWigsTrack", id)
 }
 
 function addBamTrack(id) {
-  var basePath = "/data/bamTrack/"
-  var fullPath = basePath + id
-  fetch(fullPath, {method: "GET", credentials: "same-origin"})
-  .catch((error) => {
-  console.error('Error:', error);
-}).then(data => { return data.json()}).then(tracks => addTrack(tracks))
+  loadTracks("bamTrack", id)
+}
+
+function addCramTrack(id) {
+  loadTracks("cramTrack", id)
+}
+
+function addFeaturesTrack(id) {
+  loadTracks("featuresTrack", id)
+}
+
+//samples is an optional list of sample names, colorBy an optional INFO field
+function addVcfTrack(id, samples, colorBy, settings) {
+  loadTracks("vcfTrack", id, vcfParams(samples, colorBy), settings)
+}
+
+function vcfParams(samples, colorBy) {
+  var params = new URLSearchParams()
+  for (let sample of samples || []) {
+    params.append("sample", sample)
+  }
+  if (colorBy) {
+    params.append("colorBy", colorBy)
+  }
+  return params
 }
 
 function addTrack(tracks) {
-  for (let track of tracks) {
-    igvBrowser.loadTrack(track)
+  return Promise.all(tracks.map(track =>
+    igvBrowser.loadTrack(track).then(loadedTrack => {
+      filterSamples(loadedTrack, track.samples)
+      mirrorTracks(loadedTrack)
+      return loadedTrack
+    })
+  ))
+}
+
+//mirrorTracks Draws the values of wig tracks with the mirror option below the axis, e.g. the reverse strand of a merged track
+//igv.js 2.7.4 has no option to flip a wig track, so the features are negated before they are drawn and autoscaled
+function mirrorTracks(track) {
+  if (!track) {
+    return
+  }
+
+  for (let wigTrack of [track].concat(track.tracks || [])) {
+    if (!wigTrack.config || !wigTrack.config.mirror || !wigTrack.getFeatures) {
+      continue
+    }
+
+    let getFeatures = wigTrack.getFeatures.bind(wigTrack)
+    wigTrack.getFeatures = function () {
+      return Promise.resolve(getFeatures.apply(null, arguments)).then(features =>
+        (features || []).map(feature => Object.assign({}, feature, {value: -Math.abs(feature.value)})))
+    }
+  }
+
+  if (track.trackView) {
+    track.trackView.updateViews(true)
+  }
+}
+
+//applySettings Replaces the track config with the saved settings of a track
+function applySettings(track, settings) {
+  for (let key of ["name", "color", "altColor", "displayMode", "height", "autoscale", "colorBy"]) {
+    if (settings[key] !== undefined) {
+      track[key] = settings[key]
+    }
+  }
+  if (settings.min !== undefined || settings.max !== undefined) {
+    track.min = settings.min
+    track.max = settings.max
+    track.autoscale = false
+  }
+  return track
+}
+
+//trackSettings Reads the settings of a loaded track that are stored in a saved view
+function trackSettings(kind, igvTrack) {
+  var settings = {}
+  if (!igvTrack) {
+    return settings
+  }
+  if (igvTrack.color) {
+    settings.color = igvTrack.color
+  }
+  if (igvTrack.altColor) {
+    settings.altColor = igvTrack.altColor
+  }
+  if (igvTrack.displayMode) {
+    settings.displayMode = igvTrack.displayMode
   }
-}
\ No newline at end of file
+  if (igvTrack.height) {
+    settings.height = Math.round(igvTrack.height)
+  }
+  if (igvTrack.autoscale !== undefined) {
+    settings.autoscale = igvTrack.autoscale
+  }
+  if (igvTrack.autoscale === false && igvTrack.dataRange) {
+    settings.min = igvTrack.dataRange.min
+    settings.max = igvTrack.dataRange.max
+  }
+  if (kind == "vcfTrack") {
+    if (igvTrack.config && igvTrack.config.colorBy) {
+      settings.colorBy = igvTrack.config.colorBy
+    }
+    if (igvTrack.callSets) {
+      settings.samples = igvTrack.callSets.map(callSet => callSet.name)
+    }
+  }
+  return settings
+}
+
+//currentLocus Returns the displayed locus of the browser
+function currentLocus() {
+  if (igvBrowser.currentLoci) {
+    return igvBrowser.currentLoci().join(" ")
+  }
+  return igvBrowser.referenceFrameList.map(frame => frame.getLocusString()).join(" ")
+}
+
+//saveSession Stores the current view and shows its url
+function saveSession() {
+  var name = prompt("Name of the view")
+  if (name === null) {
+    return
+  }
+
+  var tracks = []
+  for (let loaded of loadedTracks) {
+    //Tracks that were removed in the browser are not stored
+    var remaining = loaded.tracks.filter(track => igvBrowser.trackViews.some(view => view.track === track))
+    if (remaining.length == 0) {
+      continue
+    }
+    tracks.push({kind: loaded.kind, id: loaded.id, settings: trackSettings(loaded.kind, remaining[0])})
+  }
+
+  var session = {name: name, genome: currentGenome, locus: currentLocus(), tracks: tracks}
+  fetchJSON("/sessions", {
+    method: "POST",
+    headers: {"Content-Type": "application/json"},
+    body: JSON.stringify(session)
+  }).then(saved => {
+    prompt("Saved view, share it with this url", window.location.origin + "/browser/s/" + saved.id)
+  }).catch(error => showError("Could not save the view", error))
+}
+
+//importIGVSession Saves a session file of igv.js or igv-webapp as view and opens it
+function importIGVSession(file) {
+  if (!file) {
+    return
+  }
+
+  var params = new URLSearchParams({genome: currentGenome, name: file.name.replace(/\.json$/, "")})
+  file.text().then(body => fetchJSON("/sessions/import?" + params.toString(), {
+    method: "POST",
+    headers: {"Content-Type": "application/json"},
+    body: body
+  })).then(result => {
+    if (result.unmapped.length > 0) {
+      alert("These tracks were not found in the datasets of the genome:\n" + result.unmapped.join("\n"))
+    }
+    window.location.href = "/browser/s/" + result.session.id
+  }).catch(error => showError("Could not import the session", error))
+}
+
+//restoreSession Loads the locus and tracks of a saved view
+function restoreSession(id) {
+  fetchJSON("/sessions/" + encodeURIComponent(id)).then(session => {
+    if (session.locus) {
+      igvBrowser.search(session.locus)
+    }
+    for (let track of session.tracks || []) {
+      var settings = track.settings || {}
+      if (track.kind == "vcfTrack") {
+        addVcfTrack(track.id, settings.samples, settings.colorBy, settings)
+      } else {
+        loadTracks(track.kind, track.id, null, settings)
+      }
+    }
+  }).catch(error => showError("Could not restore the view", error))
+}
+
+//filterSamples Only shows the genotypes of the given samples in a variant track
+function filterSamples(track, samples) {
+  if (!samples || !track || !track.callSets) {
+    return
+  }
+
+  track.callSets = track.callSets.filter(callSet => samples.includes(callSet.name))
+  if (track.trackView) {
+    track.trackView.updateViews(true)
+  }
+}
+
+function attributeOf(track, attribute) {
+  var attributes = track.config && track.config.attributes
+  return (attributes && attributes[attribute]) || ""
+}
+
+//sortTracksByAttribute Orders the tracks with sample attributes by the value of an attribute
+function sortTracksByAttribute(attribute) {
+  var views = igvBrowser.trackViews.filter(view => view.track.config && view.track.config.attributes)
+  var orders = views.map(view => view.track.order).sort((a, b) => a - b)
+  views.sort((a, b) => attributeOf(a.track, attribute).localeCompare(attributeOf(b.track, attribute)))
+  views.forEach((view, i) => { view.track.order = orders[i] })
+  igvBrowser.reorderTracks()
+}
+
+//filterTracksByAttribute Removes the tracks with sample attributes whose attribute does not have the value
+function filterTracksByAttribute(attribute, value) {
+  for (let view of igvBrowser.trackViews.slice()) {
+    var attributes = view.track.config && view.track.config.attributes
+    if (attributes && attributes[attribute] !== value) {
+      igvBrowser.removeTrack(view.track)
+    }
+  }
+}